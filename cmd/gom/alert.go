@@ -0,0 +1,302 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui"
+)
+
+// An alertRule is a threshold on the stats of the target, such as
+//
+//	goroutines > 10000
+//	heap > 2gb
+//	heap growth > 20%/min
+//	threads rising for 60s
+type alertRule struct {
+	text   string
+	metric string // goroutines, threads or heap
+	kind   string // above, below, growth or rising
+
+	threshold float64       // for above, below and growth, in percents
+	window    time.Duration // for growth and rising
+
+	firing bool
+}
+
+// alertMetrics are the stats alert rules can be defined on.
+var alertMetrics = map[string]func(s stats) float64{
+	"goroutines": func(s stats) float64 { return float64(s.Goroutine) },
+	"threads":    func(s stats) float64 { return float64(s.Thread) },
+	"heap":       func(s stats) float64 { return float64(s.HeapAlloc) },
+}
+
+// An observation is the stats fetched at a given time.
+type observation struct {
+	t time.Time
+	s stats
+}
+
+var (
+	alertRules []*alertRule
+
+	// statsHistory holds the stats observed over the longest window of
+	// the rules, the oldest first.
+	statsHistory []observation
+)
+
+// parseAlertRule parses a rule.
+func parseAlertRule(text string) (*alertRule, error) {
+	r := &alertRule{text: text}
+	f := strings.Fields(text)
+	if len(f) == 0 {
+		return nil, fmt.Errorf("empty alert rule")
+	}
+	r.metric = f[0]
+	if _, ok := alertMetrics[r.metric]; !ok {
+		return nil, fmt.Errorf("invalid alert rule %q: unknown stat %s, expected goroutines, threads or heap", text, r.metric)
+	}
+	var err error
+	switch {
+	case len(f) == 3 && (f[1] == ">" || f[1] == "<"):
+		r.kind = "above"
+		if f[1] == "<" {
+			r.kind = "below"
+		}
+		r.threshold, err = parseQuantity(f[2])
+	case len(f) == 4 && f[1] == "growth" && f[2] == ">":
+		r.kind = "growth"
+		// e.g. 20%/min
+		i := strings.Index(f[3], "%/")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid alert rule %q: growth expected as <n>%%/<duration>", text)
+		}
+		if r.threshold, err = strconv.ParseFloat(f[3][:i], 64); err == nil {
+			r.window, err = parseWindow(f[3][i+2:])
+		}
+	case len(f) == 4 && f[1] == "rising" && f[2] == "for":
+		r.kind = "rising"
+		r.window, err = parseWindow(f[3])
+	default:
+		return nil, fmt.Errorf("invalid alert rule %q: expected <stat> > <n>, <stat> < <n>, <stat> growth > <n>%%/<duration> or <stat> rising for <duration>", text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert rule %q: %v", text, err)
+	}
+	return r, nil
+}
+
+// parseQuantity parses a number, optionally followed by a kb, mb or
+// gb unit.
+func parseQuantity(s string) (float64, error) {
+	scale := 1.0
+	lower := strings.ToLower(s)
+	for _, u := range []struct {
+		suffix string
+		scale  float64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}} {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			scale = u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(lower, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", s)
+	}
+	return v * scale, nil
+}
+
+// parseWindow parses a duration such as 30s or 5m, or one of the
+// units s, min and h.
+func parseWindow(s string) (time.Duration, error) {
+	switch s {
+	case "s", "sec":
+		return time.Second, nil
+	case "min":
+		return time.Minute, nil
+	case "h", "hour":
+		return time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %s", s)
+	}
+	return d, nil
+}
+
+// addAlert adds the rule text to the alert rules.
+func addAlert(text string) error {
+	r, err := parseAlertRule(text)
+	if err != nil {
+		return err
+	}
+	alertRules = append(alertRules, r)
+	return nil
+}
+
+// observeStats records the stats s observed at t and evaluates the
+// rules. It returns the rules that started firing.
+func observeStats(t time.Time, s stats) []*alertRule {
+	statsHistory = append(statsHistory, observation{t, s})
+	var longest time.Duration
+	for _, r := range alertRules {
+		if r.window > longest {
+			longest = r.window
+		}
+	}
+	// Keep an observation older than the longest window.
+	for len(statsHistory) > 1 && !statsHistory[1].t.After(t.Add(-longest)) {
+		statsHistory = statsHistory[1:]
+	}
+
+	var fired []*alertRule
+	for _, r := range alertRules {
+		firing := r.eval(t)
+		if firing && !r.firing {
+			fired = append(fired, r)
+		}
+		r.firing = firing
+	}
+	return fired
+}
+
+// eval reports whether the rule fires at t, given the stats history.
+func (r *alertRule) eval(t time.Time) bool {
+	value := alertMetrics[r.metric]
+	cur := value(statsHistory[len(statsHistory)-1].s)
+	switch r.kind {
+	case "above":
+		return cur > r.threshold
+	case "below":
+		return cur < r.threshold
+	}
+
+	// The other rules need the history to cover the window; start is
+	// the last observation older than the window.
+	start := -1
+	for i, o := range statsHistory {
+		if !o.t.After(t.Add(-r.window)) {
+			start = i
+		}
+	}
+	if start == -1 {
+		return false
+	}
+	switch r.kind {
+	case "growth":
+		old := value(statsHistory[start].s)
+		return old > 0 && (cur-old)/old*100 > r.threshold
+	case "rising":
+		for i := start + 1; i < len(statsHistory); i++ {
+			if value(statsHistory[i].s) < value(statsHistory[i-1].s) {
+				return false
+			}
+		}
+		return cur > value(statsHistory[start].s)
+	}
+	return false
+}
+
+// firingMetrics returns the metrics with firing rules.
+func firingMetrics() map[string]bool {
+	m := make(map[string]bool)
+	for _, r := range alertRules {
+		if r.firing {
+			m[r.metric] = true
+		}
+	}
+	return m
+}
+
+// alertProfiles are the profiles captured when a rule fires.
+var alertProfiles = []string{"heap", "goroutine"}
+
+// alertDone receives the profiles captured when rules fire, off the UI
+// goroutine, as alertResult events.
+var alertDone = make(chan ui.Event)
+
+// An alertResult is the outcome of the capture of the profiles when
+// rules fire.
+type alertResult struct {
+	msg   string
+	files []string
+	err   error
+}
+
+// startAlertCapture captures the alertProfiles of the target in the
+// background, and sends the files saved to alertDone along with msg.
+func startAlertCapture(target string, t time.Time, msg string) {
+	go func() {
+		files, err := captureAlertProfiles(target, t)
+		alertDone <- ui.Event{Path: "/gom/alert", Data: alertResult{msg, files, err}}
+	}()
+}
+
+// captureAlertProfiles saves the alertProfiles of the target in the
+// alert directory, and returns the files saved.
+func captureAlertProfiles(target string, t time.Time) ([]string, error) {
+	dir := conf.AlertDir
+	if dir == "" {
+		dir = filepath.Join(configDir(), "alerts")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range alertProfiles {
+		p, err := fetchProfile(target, name, 0)
+		if err != nil {
+			return files, err
+		}
+		file := filepath.Join(dir, fmt.Sprintf("%s-%s.pb.gz", t.Format("20060102-150405"), name))
+		f, err := os.Create(file)
+		if err != nil {
+			return files, err
+		}
+		err = p.Write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// listAlerts describes the alert rules.
+func listAlerts() string {
+	if len(alertRules) == 0 {
+		return "no alerts"
+	}
+	var s []string
+	for _, r := range alertRules {
+		item := r.text
+		if r.firing {
+			item = fmt.Sprintf("[%s (firing)](fg-red)", item)
+		}
+		s = append(s, item)
+	}
+	return "alerts: " + strings.Join(s, ", ")
+}
@@ -0,0 +1,239 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	ui "github.com/gizak/termui"
+	"github.com/rakyll/gom/internal/profile"
+	"github.com/rakyll/gom/internal/tempfile"
+)
+
+var (
+	// benchProfiles are the profile files written by the benchmarks run
+	// with gom bench, by profile name. If nil, the profiles are fetched
+	// from the target.
+	benchProfiles map[string]string
+
+	// benchResults are the result lines of the benchmarks, with their
+	// ns/op and allocs/op.
+	benchResults []string
+
+	// benchPane shows the results in place of the stats, scrolled by
+	// benchScroll lines.
+	benchPane   *ui.Par
+	benchScroll int
+)
+
+// benchProfileFlags are the go test flags writing the profiles of the
+// benchmarks, by profile name.
+var benchProfileFlags = map[string]string{
+	"profile": "-cpuprofile",
+	"heap":    "-memprofile",
+	"block":   "-blockprofile",
+	"mutex":   "-mutexprofile",
+}
+
+// bench runs the benchmarks of a package with go test, e.g.
+// gom bench ./pkg -bench X, writing their CPU, memory, block and mutex
+// profiles into a temporary directory, and opens the profiles in the
+// terminal UI along with the results of the benchmarks. The arguments
+// are passed to go test; by default all benchmarks are run with
+// -benchmem, and no tests.
+func bench(args []string) error {
+	dir, err := ioutil.TempDir("", "gom-bench")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempfile.Cleanup()
+		os.Remove(dir)
+	}()
+
+	// The arguments come last to override the defaults.
+	testArgs := []string{"test", "-run=^$", "-bench=.", "-benchmem"}
+	files := make(map[string]string)
+	for name, flag := range benchProfileFlags {
+		file, err := benchFile(dir, name, ".pb.gz")
+		if err != nil {
+			return err
+		}
+		files[name] = file
+		testArgs = append(testArgs, flag+"="+file)
+	}
+	bin, err := benchFile(dir, "bench", ".test")
+	if err != nil {
+		return err
+	}
+	testArgs = append(testArgs, "-o="+bin)
+	testArgs = append(testArgs, args...)
+
+	var out bytes.Buffer
+	cmd := exec.Command("go", testArgs...)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go test: %v", err)
+	}
+	benchResults = benchLines(out.String())
+	if len(benchResults) == 0 {
+		return fmt.Errorf("no benchmarks to profile")
+	}
+
+	// The profiles overridden by the arguments are left empty.
+	benchProfiles = make(map[string]string)
+	for name, file := range files {
+		if fi, err := os.Stat(file); err == nil && fi.Size() > 0 {
+			benchProfiles[name] = file
+		}
+	}
+	rules, err := sourcePathRules(*sourcePaths)
+	if err != nil {
+		return err
+	}
+	pathRules = rules
+	// The allocations of the benchmarks are rarely still in use.
+	heapProfile.sampleType = "alloc_space"
+	currentProfile = cpuProfile
+	runTUI()
+	return nil
+}
+
+// layoutBenchPane sizes the pane of the results to their number, up to
+// a third of the terminal, and shows them scrolled by benchScroll.
+func layoutBenchPane() {
+	n := len(benchResults)
+	if max := ui.TermHeight()/3 - 2; n > max {
+		n = max
+	}
+	if n < 1 {
+		n = 1
+	}
+	if benchScroll > len(benchResults)-n {
+		benchScroll = len(benchResults) - n
+	}
+	if benchScroll < 0 {
+		benchScroll = 0
+	}
+	benchPane.Height = n + 2
+	benchPane.Text = strings.Join(benchResults[benchScroll:benchScroll+n], "\n")
+	benchPane.BorderLabel = "benchmarks"
+	if n < len(benchResults) {
+		benchPane.BorderLabel = fmt.Sprintf("benchmarks %d-%d of %d, [ and ] to scroll",
+			benchScroll+1, benchScroll+n, len(benchResults))
+	}
+}
+
+// scrollBenchPane scrolls the results with the [ and ] keys, while the
+// prompt is empty. It reports whether key is one of them.
+func scrollBenchPane(key string) bool {
+	if benchPane == nil {
+		return false
+	}
+	switch key {
+	case "[":
+		benchScroll--
+	case "]":
+		benchScroll++
+	default:
+		return false
+	}
+	return true
+}
+
+// benchFile returns a new file in dir, deleted when gom bench exits.
+func benchFile(dir, prefix, suffix string) (string, error) {
+	f, err := tempfile.New(dir, prefix, suffix)
+	if err != nil {
+		return "", err
+	}
+	tempfile.DeferDelete(f.Name())
+	return f.Name(), f.Close()
+}
+
+// benchLines returns the result lines of the benchmarks in the output
+// of go test, aligned, or nil if there are none.
+func benchLines(out string) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "Benchmark") || !strings.Contains(line, "ns/op") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	w.Flush()
+	if buf.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// benchProfile reads the named profile of the benchmarks.
+func benchProfile(name string) (*profile.Profile, error) {
+	file, ok := benchProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("no %s profile for the benchmarks; profiles are: %s", name, strings.Join(benchProfileNames(), ", "))
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return profile.Parse(f)
+}
+
+// benchProfileNames returns the names of the profiles of the
+// benchmarks.
+func benchProfileNames() []string {
+	var names []string
+	for name := range benchProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// targetCommands are the prompt commands that need a target, and so
+// are not available with gom bench.
+var targetCommands = map[string]bool{
+	":t":         true,
+	":growth":    true,
+	":leaks":     true,
+	":rate":      true,
+	":target":    true,
+	":instances": true,
+	":alert":     true,
+}
+
+// needsTarget reports whether the prompt command cmd needs a target
+// while the profiles of benchmarks are shown.
+func needsTarget(cmd string) bool {
+	f := strings.Fields(cmd)
+	return benchProfiles != nil && len(f) > 0 && targetCommands[f[0]]
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBenchLines(t *testing.T) {
+	tests := []struct {
+		out  string
+		want []string
+	}{
+		{"", nil},
+		{"PASS\nok  \texample.com/x\t0.01s\n", nil},
+		{"BenchmarkFoo is not a result\n", nil},
+		{
+			"goos: linux\n" +
+				"BenchmarkFoo-8   \t 1000000\t      1042 ns/op\t      64 B/op\t       2 allocs/op\n" +
+				"BenchmarkLongerName-8\t 20\t  51200000 ns/op\n" +
+				"PASS\n",
+			[]string{
+				"BenchmarkFoo-8         1000000  1042 ns/op  64 B/op  2 allocs/op",
+				"BenchmarkLongerName-8  20       51200000 ns/op",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := benchLines(tt.out); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("benchLines(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
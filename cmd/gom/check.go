@@ -0,0 +1,394 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// A checkRule limits the value of the functions matching a regexp in a
+// profile, read from a rules file:
+//
+//	rules:
+//	  - name: regexp stays cold
+//	    focus: ^regexp\.
+//	    value: cum
+//	    max_percent: 5
+//	  - name: package y allocations
+//	    focus: ^github\.com/me/y\.
+//	    sample_type: alloc_space
+//	    max_growth: 10
+type checkRule struct {
+	Name string `json:"name"`
+
+	// Focus and Ignore select the samples, as the focus and ignore
+	// filters do.
+	Focus  string `json:"focus"`
+	Ignore string `json:"ignore,omitempty"`
+
+	// SampleType is the sample type checked, or empty for the default
+	// one of the profile.
+	SampleType string `json:"sample_type,omitempty"`
+
+	// Value is cum, the value of the samples with a matching function,
+	// or flat, the value of the matching functions themselves.
+	Value string `json:"value"`
+
+	// MaxPercent is the maximum share of the total of the value, and
+	// MaxGrowth the maximum growth of the value against the base
+	// profile, both in percent. Zero means no limit.
+	MaxPercent float64 `json:"max_percent,omitempty"`
+	MaxGrowth  float64 `json:"max_growth,omitempty"`
+
+	focus, ignore *regexp.Regexp
+}
+
+// A checkResult is the outcome of a rule, as written by gom check.
+type checkResult struct {
+	*checkRule
+
+	Passed  bool     `json:"passed"`
+	Message string   `json:"message"`
+	Current int64    `json:"current"`
+	Percent float64  `json:"percent"`
+	Base    *int64   `json:"base,omitempty"`
+	Growth  *float64 `json:"growth,omitempty"`
+	Unit    string   `json:"unit"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// check checks the rules of a rules file against a profile and a base
+// profile, writes the results as JSON, and fails if a rule is
+// violated. Violated rules are a failure, to tell them from the errors
+// fetching the profiles.
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	base := fs.String("base", "", "the base profile to check the growth against: a file or a gom target such as localhost:6060/heap")
+	prof := fs.String("profile", "", "the profile to check, as the base one")
+	rulesFile := fs.String("rules", "", "the rules file")
+	fs.Parse(args)
+	if *prof == "" || *rulesFile == "" {
+		fs.Usage()
+		return fmt.Errorf("both -profile and -rules are required")
+	}
+
+	data, err := ioutil.ReadFile(*rulesFile)
+	if err != nil {
+		return err
+	}
+	rules, err := parseRules(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", *rulesFile, err)
+	}
+	p, err := fetchSource(*prof)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *prof, err)
+	}
+	var bp *profile.Profile
+	if *base != "" {
+		if bp, err = fetchSource(*base); err != nil {
+			return fmt.Errorf("%s: %v", *base, err)
+		}
+	}
+
+	out := struct {
+		Passed bool           `json:"passed"`
+		Rules  []*checkResult `json:"rules"`
+	}{Passed: true}
+	var failed []string
+	for _, r := range rules {
+		res := checkProfile(r, p, bp)
+		if !res.Passed {
+			out.Passed = false
+			failed = append(failed, res.Message)
+		}
+		out.Rules = append(out.Rules, res)
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", b)
+	if len(failed) > 0 {
+		return failure{fmt.Errorf("%d of %d rules failed:\n%s", len(failed), len(rules), strings.Join(failed, "\n"))}
+	}
+	return nil
+}
+
+// checkProfile checks the rule r against the profile p and the base
+// profile bp, which may be nil if r has no growth limit.
+func checkProfile(r *checkRule, p, bp *profile.Profile) *checkResult {
+	res := &checkResult{checkRule: r}
+	fail := func(err error) *checkResult {
+		res.Error = err.Error()
+		res.Message = fmt.Sprintf("%s: %v", r.Name, err)
+		return res
+	}
+	v, total, unit, rpt, err := ruleValue(r, p)
+	if err != nil {
+		return fail(err)
+	}
+	res.Current, res.Unit = v, unit
+	if total != 0 {
+		res.Percent = float64(v) / float64(total) * 100
+	}
+	var violations []string
+	if r.MaxPercent > 0 && res.Percent > r.MaxPercent {
+		violations = append(violations, fmt.Sprintf("%.2f%% of the total, over %g%%", res.Percent, r.MaxPercent))
+	}
+	if r.MaxGrowth > 0 {
+		if bp == nil {
+			return fail(fmt.Errorf("no base profile to check the growth against"))
+		}
+		bv, _, _, _, err := ruleValue(r, bp)
+		if err != nil {
+			return fail(fmt.Errorf("base profile: %v", err))
+		}
+		res.Base = &bv
+		if bv != 0 {
+			g := float64(v-bv) / float64(bv) * 100
+			res.Growth = &g
+			if g > r.MaxGrowth {
+				violations = append(violations, fmt.Sprintf("grew by %.2f%% from %s, over %g%%", g, rpt.FormatValue(bv), r.MaxGrowth))
+			}
+		} else if v != 0 {
+			violations = append(violations, "new since the base profile")
+		}
+	}
+
+	res.Passed = len(violations) == 0
+	res.Message = fmt.Sprintf("%s: %s of %s is %s", r.Name, r.Value, r.Focus, rpt.FormatValue(v))
+	if !res.Passed {
+		res.Message += ", " + strings.Join(violations, ", ")
+	}
+	return res
+}
+
+// ruleValue returns the value of the rule in p, the total value of p,
+// their unit and the report formatting them.
+func ruleValue(r *checkRule, p *profile.Profile) (v, total int64, unit string, rpt *goreport.Report, err error) {
+	value, _, unit, err := driver.SampleValue(p, r.SampleType)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	unit = strings.ToLower(unit)
+	for _, s := range p.Sample {
+		total += value(s)
+	}
+	p = p.Copy()
+	p.FilterSamplesByName(r.focus, r.ignore, nil)
+	if r.Value == "flat" {
+		if err := driver.Aggregate(p, "functions"); err != nil {
+			return 0, 0, "", nil, err
+		}
+	}
+	rpt, err = newReport(p, r.SampleType, goreport.Options{OutputUnit: "minimum"})
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+
+	if r.Value == "cum" {
+		for _, s := range p.Sample {
+			v += value(s)
+		}
+		return v, total, unit, rpt, nil
+	}
+	t, err := goreport.NewTable(rpt)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	for _, row := range t.Rows {
+		if r.focus.MatchString(row.Function) && (r.ignore == nil || !r.ignore.MatchString(row.Function)) {
+			v += row.Flat
+		}
+	}
+	return v, total, unit, rpt, nil
+}
+
+// parseRules parses a rules file. It is YAML, limited to a list of
+// rules of scalar fields, possibly under a rules key.
+func parseRules(data string) ([]*checkRule, error) {
+	var rules []*checkRule
+	var cur *checkRule
+	for i, line := range strings.Split(data, "\n") {
+		s := strings.TrimSpace(line)
+		if s == "" || strings.HasPrefix(s, "#") || s == "---" {
+			continue
+		}
+		if s == line && !strings.HasPrefix(s, "-") {
+			// The only top-level key is rules, a list.
+			kv := strings.SplitN(s, ":", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) != "rules" {
+				return nil, fmt.Errorf("line %d: unknown top-level key %s, want rules", i+1, kv[0])
+			}
+			if v, err := yamlScalar(strings.TrimSpace(kv[1])); err != nil || v != "" {
+				return nil, fmt.Errorf("line %d: rules must be a list of rules starting with -", i+1)
+			}
+			continue
+		}
+		if s == "-" || strings.HasPrefix(s, "- ") {
+			cur = &checkRule{}
+			rules = append(rules, cur)
+			if s = strings.TrimSpace(s[1:]); s == "" {
+				continue
+			}
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("line %d: want a rule starting with -", i+1)
+		}
+		kv := strings.SplitN(s, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: want key: value", i+1)
+		}
+		v, err := yamlScalar(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if err := cur.set(strings.TrimSpace(kv[0]), v); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules")
+	}
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// yamlScalar returns the value of a YAML scalar, quoted or plain,
+// possibly followed by a comment.
+func yamlScalar(s string) (string, error) {
+	var v, rest string
+	switch {
+	case strings.HasPrefix(s, "'"):
+		// Quotes are escaped by doubling them.
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\'' {
+				if end+1 < len(s) && s[end+1] == '\'' {
+					end++
+					continue
+				}
+				break
+			}
+		}
+		if end >= len(s) {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		v, rest = strings.Replace(s[1:end], "''", "'", -1), s[end+1:]
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		var err error
+		if v, err = strconv.Unquote(s[:end+1]); err != nil {
+			return "", fmt.Errorf("invalid string %s: %v", s[:end+1], err)
+		}
+		rest = s[end+1:]
+	default:
+		if strings.HasPrefix(s, "#") {
+			return "", nil
+		}
+		if i := strings.Index(s, " #"); i >= 0 {
+			s = s[:i]
+		}
+		return strings.TrimSpace(s), nil
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %s after string", rest)
+	}
+	return v, nil
+}
+
+// set sets the field key of the rule.
+func (r *checkRule) set(key, value string) error {
+	number := func(f *float64) error {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		*f = v
+		return nil
+	}
+	switch key {
+	case "name":
+		r.Name = value
+	case "focus":
+		r.Focus = value
+	case "ignore":
+		r.Ignore = value
+	case "sample_type":
+		r.SampleType = value
+	case "value":
+		r.Value = value
+	case "max_percent":
+		return number(&r.MaxPercent)
+	case "max_growth":
+		return number(&r.MaxGrowth)
+	default:
+		return fmt.Errorf("unknown key %s", key)
+	}
+	return nil
+}
+
+// compile validates the rule and compiles its regexps.
+func (r *checkRule) compile() error {
+	if r.Focus == "" {
+		return fmt.Errorf("no focus")
+	}
+	if r.Name == "" {
+		r.Name = r.Focus
+	}
+	switch r.Value {
+	case "":
+		r.Value = "cum"
+	case "cum", "flat":
+	default:
+		return fmt.Errorf("invalid value %q, want cum or flat", r.Value)
+	}
+	if r.MaxPercent == 0 && r.MaxGrowth == 0 {
+		return fmt.Errorf("no max_percent nor max_growth")
+	}
+	var err error
+	if r.focus, err = regexp.Compile(r.Focus); err != nil {
+		return fmt.Errorf("invalid focus: %v", err)
+	}
+	if r.Ignore != "" {
+		if r.ignore, err = regexp.Compile(r.Ignore); err != nil {
+			return fmt.Errorf("invalid ignore: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		data string
+		want []checkRule // fields set in the file, and defaults
+		err  string      // substring of the error, if any
+	}{
+		{
+			data: `
+# rules of the service
+rules:  # all of them
+  - name: regexp stays cold
+    focus: ^regexp\.
+    max_percent: 5
+  - focus: '^encoding/json\.'   # quoted
+    ignore: "Marshal\\w+"
+    sample_type: alloc_space
+    value: flat
+    max_growth: 10%
+`,
+			want: []checkRule{
+				{Name: "regexp stays cold", Focus: `^regexp\.`, Value: "cum", MaxPercent: 5},
+				{Name: `^encoding/json\.`, Focus: `^encoding/json\.`, Ignore: `Marshal\w+`,
+					SampleType: "alloc_space", Value: "flat", MaxGrowth: 10},
+			},
+		},
+		{
+			// No rules key, a plain value with a # and '' in a quote.
+			data: "- focus: a#b # comment\n  name: 'it''s'\n  max_percent: 1.5\n",
+			want: []checkRule{{Name: "it's", Focus: "a#b", Value: "cum", MaxPercent: 1.5}},
+		},
+		{
+			data: "-\n  focus: x\n  max_growth: 0.5\n",
+			want: []checkRule{{Name: "x", Focus: "x", Value: "cum", MaxGrowth: 0.5}},
+		},
+		{data: "", err: "no rules"},
+		{data: "rules:\n", err: "no rules"},
+		{data: "checks:\n  - focus: x\n", err: "line 1: unknown top-level key checks"},
+		{data: "rules: x\n", err: "line 1: rules must be a list"},
+		{data: "  focus: x\n", err: "line 1: want a rule starting with -"},
+		{data: "- focus x\n", err: "line 1: want key: value"},
+		{data: "- focus: x\n  colour: red\n", err: "line 2: unknown key colour"},
+		{data: "- focus: 'x\n", err: "line 1: unterminated string"},
+		{data: "- focus: \"x\n", err: "line 1: unterminated string"},
+		{data: "- focus: \"\\q\"\n", err: "line 1: invalid string"},
+		{data: "- focus: 'x' y\n", err: "line 1: unexpected y after string"},
+		{data: "- focus: x\n  max_percent: five\n", err: `line 2: invalid max_percent "five"`},
+		{data: "- focus: x\n  max_growth: -1\n", err: `line 2: invalid max_growth "-1"`},
+		{data: "- name: x\n  max_percent: 1\n", err: "rule 1: no focus"},
+		{data: "- focus: x\n", err: "rule 1: no max_percent nor max_growth"},
+		{data: "- focus: x\n  max_percent: 1\n  value: total\n", err: `rule 1: invalid value "total"`},
+		{data: "- focus: x(\n  max_percent: 1\n", err: "rule 1: invalid focus"},
+		{data: "- focus: x\n  ignore: '['\n  max_percent: 1\n", err: "rule 1: invalid ignore"},
+	}
+	for _, tt := range tests {
+		rules, err := parseRules(tt.data)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseRules(%q): got error %v, want %q", tt.data, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRules(%q): %v", tt.data, err)
+			continue
+		}
+		if len(rules) != len(tt.want) {
+			t.Errorf("parseRules(%q): got %d rules, want %d", tt.data, len(rules), len(tt.want))
+			continue
+		}
+		for i, r := range rules {
+			if r.focus == nil {
+				t.Errorf("parseRules(%q): rule %d: focus not compiled", tt.data, i+1)
+			}
+			got := *r
+			got.focus, got.ignore = nil, nil
+			if got != tt.want[i] {
+				t.Errorf("parseRules(%q): rule %d: got %+v, want %+v", tt.data, i+1, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckHostPort(t *testing.T) {
+	s, target := serveProfile(t, "profile", testProfile(
+		testSample{30, []string{"regexp.Compile", "main.main"}},
+		testSample{70, []string{"main.main"}},
+	))
+	defer s.Close()
+	f, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("rules:\n  - focus: ^regexp\\.\n    max_percent: 20\n")
+	f.Close()
+
+	err = check([]string{"-profile=" + target + "/profile", "-rules=" + f.Name()})
+	if _, ok := err.(failure); !ok {
+		t.Errorf("check of %s/profile: got error %v, want a failure", target, err)
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	// main.main calls main.a, which calls regexp.Compile.
+	p := testProfile(
+		testSample{20, []string{"regexp.Compile", "main.a", "main.main"}},
+		testSample{20, []string{"main.a", "main.main"}},
+		testSample{60, []string{"main.main"}},
+	)
+	base := testProfile(
+		testSample{10, []string{"regexp.Compile", "main.a", "main.main"}},
+		testSample{10, []string{"main.a", "main.main"}},
+		testSample{80, []string{"main.main"}},
+	)
+	tests := []struct {
+		rule    checkRule
+		noBase  bool
+		passed  bool
+		current int64
+		percent float64
+		base    int64  // if >= 0, the value in the base profile
+		err     string // substring of the error, if any
+	}{
+		{rule: checkRule{Focus: `^main\.a$`, MaxPercent: 50}, passed: true, current: 40, percent: 40, base: -1},
+		{rule: checkRule{Focus: `^main\.a$`, MaxPercent: 30}, current: 40, percent: 40, base: -1},
+		{rule: checkRule{Focus: `^main\.a$`, Value: "flat", MaxPercent: 30}, passed: true, current: 20, percent: 20, base: -1},
+		// Ignore drops the samples of regexp.Compile, and so the
+		// flat value of main.a in them.
+		{rule: checkRule{Focus: `^main\.`, Ignore: `^regexp\.`, Value: "flat", MaxPercent: 70}, current: 80, percent: 80, base: -1},
+		{rule: checkRule{Focus: `^main\.main$`, Value: "flat", MaxPercent: 70}, passed: true, current: 60, percent: 60, base: -1},
+		{rule: checkRule{Focus: `^main\.a$`, MaxGrowth: 10}, current: 40, percent: 40, base: 20},
+		{rule: checkRule{Focus: `^main\.a$`, MaxGrowth: 150}, passed: true, current: 40, percent: 40, base: 20},
+		{rule: checkRule{Focus: `^main\.main$`, Value: "flat", MaxGrowth: 1}, passed: true, current: 60, percent: 60, base: 80},
+		{rule: checkRule{Focus: `^main\.a$`, MaxGrowth: 10}, noBase: true, current: 40, percent: 40, base: -1, err: "no base profile"},
+		// Missing functions have no value, and are new if they
+		// have one but not in the base profile.
+		{rule: checkRule{Focus: `^nope$`, MaxPercent: 1, MaxGrowth: 1}, passed: true, base: 0},
+		{rule: checkRule{Focus: `^regexp\.`, SampleType: "bogus", MaxPercent: 1}, base: -1, err: "bogus"},
+	}
+	for _, tt := range tests {
+		r := tt.rule
+		if err := r.compile(); err != nil {
+			t.Fatalf("%+v: %v", tt.rule, err)
+		}
+		bp := base
+		if tt.noBase {
+			bp = nil
+		}
+		res := checkProfile(&r, p, bp)
+		if tt.err != "" {
+			if res.Passed || !strings.Contains(res.Error, tt.err) {
+				t.Errorf("%s: got passed %v, error %q, want error %q", r.Name, res.Passed, res.Error, tt.err)
+			}
+			continue
+		}
+		if res.Error != "" {
+			t.Errorf("%s: %s", r.Name, res.Error)
+			continue
+		}
+		if res.Passed != tt.passed || res.Current != tt.current || res.Percent != tt.percent {
+			t.Errorf("%s %s: got passed %v, %d, %g%%, want %v, %d, %g%%", r.Value, r.Name,
+				res.Passed, res.Current, res.Percent, tt.passed, tt.current, tt.percent)
+		}
+		switch {
+		case tt.base < 0 && res.Base != nil:
+			t.Errorf("%s %s: got base %d, want none", r.Value, r.Name, *res.Base)
+		case tt.base >= 0 && (res.Base == nil || *res.Base != tt.base):
+			t.Errorf("%s %s: got base %v, want %d", r.Value, r.Name, res.Base, tt.base)
+		}
+	}
+
+	// A function new since the base profile fails a growth limit.
+	r := checkRule{Focus: `^regexp\.`, MaxGrowth: 1000}
+	if err := r.compile(); err != nil {
+		t.Fatal(err)
+	}
+	res := checkProfile(&r, p, testProfile(testSample{100, []string{"main.main"}}))
+	if res.Passed || !strings.Contains(res.Message, "new since the base profile") {
+		t.Errorf("new function: got passed %v, %q, want a failure as new", res.Passed, res.Message)
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prof := filepath.Join(dir, "cpu.pb.gz")
+	f, err := os.Create(prof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testProfile(
+		testSample{30, []string{"regexp.Compile", "main.main"}},
+		testSample{70, []string{"main.main"}},
+	).Write(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := filepath.Join(dir, "rules.yaml")
+
+	tests := []struct {
+		profile string
+		rules   string
+		failure bool // whether the error is a failure, exiting with 1
+		err     bool
+	}{
+		{prof, "- focus: ^regexp\\.\n  max_percent: 50\n", false, false},
+		{prof, "- focus: ^regexp\\.\n  max_percent: 20\n", true, true},
+		{filepath.Join(dir, "missing.pb.gz"), "- focus: x\n  max_percent: 1\n", false, true},
+		{prof, "- focus: x\n", false, true},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(rules, []byte(tt.rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := check([]string{"-profile=" + tt.profile, "-rules=" + rules})
+		_, isFailure := err.(failure)
+		if (err != nil) != tt.err || isFailure != tt.failure {
+			t.Errorf("check of %s with %q: got error %v, want error %v, failure %v", tt.profile, tt.rules, err, tt.err, tt.failure)
+		}
+	}
+}
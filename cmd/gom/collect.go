@@ -0,0 +1,352 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPush is the maximum size of the data pushed by agents.
+const maxPush = 64 << 20
+
+// nameRx matches the valid service, instance and profile names, but
+// the names starting with a dot, which validName rejects.
+var nameRx = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validName reports whether s is a valid service, instance or profile
+// name. Names starting with a dot, such as . and .., are not, not to
+// escape the directory of the collector.
+func validName(s string) bool {
+	return nameRx.MatchString(s) && !strings.HasPrefix(s, ".")
+}
+
+// collect runs a collector, receiving the stats and the profiles pushed
+// by the agents of the http package. Each instance is served as a gom
+// target at /<service>/<instance>.
+func collect(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	listen := fs.String("listen", ":7070", "the address to listen on")
+	dir := fs.String("dir", filepath.Join(configDir(), "collect"), "the directory to store the pushed data in")
+	keep := fs.Int("keep", 100, "the number of pushed profiles to keep per profile and instance")
+	fs.Parse(args)
+	if *keep < 1 {
+		return fmt.Errorf("invalid -keep %d, want at least 1", *keep)
+	}
+
+	c := &collector{dir: *dir, keep: *keep, instances: make(map[string]*instance)}
+	if err := c.load(); err != nil {
+		return err
+	}
+	log.Printf("Collecting into %s, listening on %s", *dir, *listen)
+	return http.ListenAndServe(*listen, c)
+}
+
+// A collector stores the data pushed by the agents into a directory
+// per instance: the stats are appended to stats.jsonl, and the profiles
+// are saved as <name>-<time>.pb.gz, keeping the latest keep ones.
+type collector struct {
+	dir  string
+	keep int
+
+	mu        sync.Mutex
+	instances map[string]*instance // by service/instance
+}
+
+// An instance is an instance of a service pushing to the collector.
+type instance struct {
+	Service  string            `json:"service"`
+	Instance string            `json:"instance"`
+	LastPush time.Time         `json:"last_push"`
+	Profiles map[string]string `json:"profiles"` // latest profile files, by name
+
+	stats []byte // latest stats
+}
+
+func (i *instance) key() string { return i.Service + "/" + i.Instance }
+
+type instances []*instance
+
+func (s instances) Len() int           { return len(s) }
+func (s instances) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s instances) Less(i, j int) bool { return s[i].key() < s[j].key() }
+
+// load loads the instances stored in the directory.
+func (c *collector) load() error {
+	dirs, err := filepath.Glob(filepath.Join(c.dir, "*", "*"))
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		service, name := filepath.Base(filepath.Dir(d)), filepath.Base(d)
+		if !validName(service) || !validName(name) {
+			continue
+		}
+		i := c.instance(service, name)
+		if fi, err := os.Stat(d); err == nil {
+			i.LastPush = fi.ModTime()
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(d, "stats.jsonl")); err == nil {
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			i.stats = []byte(lines[len(lines)-1])
+		}
+		for name, files := range profileFiles(d) {
+			i.Profiles[name] = files[len(files)-1]
+			c.prune(d, files)
+		}
+	}
+	return nil
+}
+
+// profileFiles returns the files of the profiles in dir, by profile
+// name, sorted by time. Other files are skipped.
+func profileFiles(dir string) map[string][]string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.pb.gz"))
+	sort.Strings(files)
+	m := make(map[string][]string)
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".pb.gz")
+		i := strings.LastIndex(name, "-")
+		if i <= 0 || !validName(name[:i]) {
+			continue
+		}
+		m[name[:i]] = append(m[name[:i]], filepath.Base(f))
+	}
+	return m
+}
+
+// prune removes the oldest of the files of a profile in dir, sorted by
+// time, but the latest c.keep ones.
+func (c *collector) prune(dir string, files []string) {
+	for len(files) > c.keep {
+		if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+			log.Print(err)
+		}
+		files = files[1:]
+	}
+}
+
+// instanceDir returns the directory of the named instance. It reports
+// false if the directory is not under c.dir.
+func (c *collector) instanceDir(service, name string) (string, bool) {
+	dir := filepath.Join(c.dir, service, name)
+	rel, err := filepath.Rel(c.dir, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return dir, true
+}
+
+// instance returns the named instance, creating it if needed. c.mu
+// must be held, or c not shared yet.
+func (c *collector) instance(service, name string) *instance {
+	key := service + "/" + name
+	i, ok := c.instances[key]
+	if !ok {
+		i = &instance{Service: service, Instance: name, Profiles: make(map[string]string)}
+		c.instances[key] = i
+	}
+	return i
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "":
+		c.serveIndex(w)
+		return
+	case len(path) != 4 || !validName(path[0]) || !validName(path[1]):
+	case path[2] == "push" && r.Method == "POST":
+		c.servePush(w, r, path[0], path[1], path[3])
+		return
+	case path[2] == "debug" && path[3] == "_gom":
+		c.serveTarget(w, r, path[0], path[1])
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// serveIndex lists the instances.
+func (c *collector) serveIndex(w http.ResponseWriter) {
+	c.mu.Lock()
+	var l instances
+	for _, i := range c.instances {
+		l = append(l, i)
+	}
+	sort.Sort(l)
+	b, err := json.MarshalIndent(l, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// servePush stores the stats or the profile pushed by an instance.
+func (c *collector) servePush(w http.ResponseWriter, r *http.Request, service, name, kind string) {
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPush+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxPush {
+		http.Error(w, fmt.Sprintf("pushed data over %d bytes", maxPush), http.StatusRequestEntityTooLarge)
+		return
+	}
+	dir, ok := c.instanceDir(service, name)
+	if !ok {
+		http.Error(w, "invalid service or instance name", http.StatusBadRequest)
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.instance(service, name)
+	switch kind {
+	case "stats":
+		var s stats
+		if err := json.Unmarshal(data, &s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid stats: %v", err), http.StatusBadRequest)
+			return
+		}
+		f, err := os.OpenFile(filepath.Join(dir, "stats.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%s\n", strings.TrimSpace(string(data)))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i.stats = data
+	case "profile":
+		p := r.FormValue("name")
+		if !validName(p) {
+			http.Error(w, "invalid profile name", http.StatusBadRequest)
+			return
+		}
+		file := fmt.Sprintf("%s-%s.pb.gz", p, now.UTC().Format("20060102T150405.000"))
+		if err := ioutil.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i.Profiles[p] = file
+		c.prune(dir, profileFiles(dir)[p])
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	i.LastPush = now
+}
+
+// serveTarget serves the latest stats and profiles of an instance, as
+// the handler of the http package does.
+func (c *collector) serveTarget(w http.ResponseWriter, r *http.Request, service, name string) {
+	dir, ok := c.instanceDir(service, name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	c.mu.Lock()
+	i, ok := c.instances[service+"/"+name]
+	var stats []byte
+	var file string
+	if ok {
+		stats = i.stats
+		file = i.Profiles[r.FormValue("name")]
+	}
+	c.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.FormValue("view") {
+	case "":
+		if stats == nil {
+			http.Error(w, "no stats pushed yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(stats)
+	case "profile":
+		if file == "" {
+			http.Error(w, fmt.Sprintf("no %s profile pushed yet", r.FormValue("name")), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeFile(w, r, filepath.Join(dir, file))
+	case "list":
+		// The counts of the pushed profiles are not known.
+		c.mu.Lock()
+		var l []profileInfo
+		for name := range i.Profiles {
+			l = append(l, profileInfo{Name: name})
+		}
+		c.mu.Unlock()
+		sort.Sort(profileInfos(l))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l)
+	case "symbol":
+		// Pushed profiles are symbolized.
+		fmt.Fprintln(w, "num_symbols: 0")
+	default:
+		http.Error(w, "not available from a collector", http.StatusNotImplemented)
+	}
+}
+
+// fetchInstances lists the instances known to a collector, as
+// service/instance.
+func fetchInstances(collector string) ([]string, error) {
+	c := &http.Client{Timeout: 10 * time.Second}
+	resp, err := c.Get(collector + "/")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server response: %s", resp.Status)
+	}
+	var l instances
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, i := range l {
+		names = append(names, i.key())
+	}
+	return names, nil
+}
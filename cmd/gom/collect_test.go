@@ -0,0 +1,73 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectorPaths(t *testing.T) {
+	root, err := ioutil.TempDir("", "collect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "a", "b")
+	c := &collector{dir: dir, keep: 1, instances: make(map[string]*instance)}
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/../../push/stats", http.StatusNotFound},
+		{"/svc/../push/stats", http.StatusNotFound},
+		{"/./svc/push/stats", http.StatusNotFound},
+		{"/.svc/i/push/stats", http.StatusNotFound},
+		{"/svc/i/push/profile?name=..", http.StatusBadRequest},
+		{"/svc/i/push/stats", http.StatusOK},
+	}
+	for _, tt := range tests {
+		// The path is not cleaned, as when c is served without a
+		// ServeMux.
+		r := httptest.NewRequest("POST", tt.path, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("POST %s: got status %d, want %d", tt.path, w.Code, tt.code)
+		}
+	}
+
+	var files []string
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	want := filepath.Join(dir, "svc", "i", "stats.jsonl")
+	if len(files) != 1 || files[0] != want {
+		t.Errorf("got files %q, want only %s", files, want)
+	}
+
+	if _, ok := c.instanceDir("..", ".."); ok {
+		t.Error("instanceDir(.., ..) is under the collector directory")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/plugin"
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// compare compares two sets of profiles, e.g. the CPU profiles of
+// several runs of a benchmark before and after a change, and reports
+// the functions whose values changed beyond the run to run noise.
+// Regressions over the threshold are a failure, to tell them from the
+// errors fetching the profiles.
+func compare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	base := fs.String("base", "", "comma-separated base profiles: files, globs or gom targets such as localhost:6060/heap")
+	test := fs.String("test", "", "comma-separated test profiles, as the base ones")
+	stype := fs.String("sample_index", "", "the sample type to compare, e.g. alloc_space; the default one of the profiles if empty")
+	granularity := fs.String("granularity", "functions", "compare by functions, files, lines, addresses or packages")
+	cum := fs.Bool("cum", false, "compare the cumulative values instead of the flat ones")
+	alpha := fs.Float64("alpha", 0.05, "the significance level of the changes")
+	threshold := fs.Float64("threshold", 0, "fail if a value grows significantly by more than this percentage; 0 to never fail")
+	asJSON := fs.Bool("json", false, "write the comparison as JSON")
+	fs.Parse(args)
+	if *base == "" || *test == "" {
+		fs.Usage()
+		return fmt.Errorf("both -base and -test profiles are required")
+	}
+	if *alpha <= 0 || *alpha >= 1 {
+		return fmt.Errorf("invalid -alpha %g, want a value between 0 and 1", *alpha)
+	}
+
+	load := func(sources string) ([]*goreport.Report, error) {
+		var rpts []*goreport.Report
+		for _, src := range expandSources(sources) {
+			rpt, err := compareReport(src, *stype, *granularity, *cum)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", src, err)
+			}
+			rpts = append(rpts, rpt)
+		}
+		return rpts, nil
+	}
+	baseRpts, err := load(*base)
+	if err != nil {
+		return err
+	}
+	testRpts, err := load(*test)
+	if err != nil {
+		return err
+	}
+	c, err := goreport.Compare(baseRpts, testRpts, *alpha)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		err = c.WriteJSON(os.Stdout)
+	} else {
+		err = c.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *threshold > 0 {
+		var regressions []string
+		for _, r := range c.Rows {
+			if r.Significant && r.Delta > *threshold && r.TestMean > r.BaseMean {
+				if math.IsInf(r.Delta, 1) {
+					regressions = append(regressions, r.Name+" (new)")
+				} else {
+					regressions = append(regressions, fmt.Sprintf("%s (%+.1f%%)", r.Name, r.Delta))
+				}
+			}
+		}
+		if len(regressions) > 0 {
+			return failure{fmt.Errorf("%d significant regressions over %g%%: %s", len(regressions), *threshold, strings.Join(regressions, ", "))}
+		}
+	}
+	return nil
+}
+
+// expandSources splits the comma-separated profile sources, expanding
+// the globs matching files.
+func expandSources(sources string) []string {
+	var l []string
+	for _, src := range strings.Split(sources, ",") {
+		src = strings.TrimSpace(src)
+		if src == "" {
+			continue
+		}
+		if files, _ := filepath.Glob(src); len(files) > 0 {
+			l = append(l, files...)
+			continue
+		}
+		l = append(l, src)
+	}
+	return l
+}
+
+// fetchSource fetches and symbolizes the profile src, a file or a
+// profile of a gom target.
+func fetchSource(src string) (*profile.Profile, error) {
+	src = sourceURL(src)
+	ui := plugin.StandardUI()
+	p, err := fetchPProf(src, 60*time.Second, ui)
+	if err != nil {
+		return nil, err
+	}
+	if err := symbolizePProf("", src, p, nil, ui); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// sourceURL adds http:// to the sources of the form host:port/path, as
+// the driver does for the pprof command, and returns files and other
+// URLs unchanged.
+func sourceURL(src string) string {
+	if _, err := os.Stat(src); err == nil {
+		return src
+	}
+	// url.Parse treats host as the scheme.
+	u, err := url.Parse(src)
+	if err != nil || (u.Host == "" && u.Scheme != "" && u.Scheme != "file") {
+		return "http://" + src
+	}
+	return src
+}
+
+// compareReport fetches the profile src and builds the report of its
+// sample type stype at the given granularity.
+func compareReport(src, stype, granularity string, cum bool) (*goreport.Report, error) {
+	p, err := fetchSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := driver.Aggregate(p, granularity); err != nil {
+		return nil, err
+	}
+	return newReport(p, stype, goreport.Options{CumSort: cum, OutputUnit: "minimum"})
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rakyll/gom/internal/profile"
+)
+
+// A testSample is a sample of testProfile, of a value and a stack of
+// functions, leaf first.
+type testSample struct {
+	v     int64
+	stack []string
+}
+
+// testProfile returns a CPU profile of the given samples.
+func testProfile(samples ...testSample) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     1,
+	}
+	locs := make(map[string]*profile.Location)
+	for _, s := range samples {
+		sample := &profile.Sample{Value: []int64{s.v}}
+		for _, name := range s.stack {
+			l, ok := locs[name]
+			if !ok {
+				id := uint64(len(locs) + 1)
+				f := &profile.Function{ID: id, Name: name, SystemName: name}
+				l = &profile.Location{ID: id, Line: []profile.Line{{Function: f}}}
+				p.Function = append(p.Function, f)
+				p.Location = append(p.Location, l)
+				locs[name] = l
+			}
+			sample.Location = append(sample.Location, l)
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	return p
+}
+
+// serveProfile serves p as the named profile of a gom target, and
+// returns the target as host:port.
+func serveProfile(t *testing.T, name string, p *profile.Profile) (*httptest.Server, string) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/debug/_gom":
+			http.NotFound(w, r)
+		case r.FormValue("view") == "symbol":
+			w.Write([]byte("num_symbols: 0\n"))
+		case r.FormValue("view") == "profile" && r.FormValue("name") == name:
+			if err := p.Write(w); err != nil {
+				t.Error(err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return s, strings.TrimPrefix(s.URL, "http://")
+}
+
+func TestFetchSourceHostPort(t *testing.T) {
+	s, target := serveProfile(t, "heap", testProfile(testSample{10, []string{"main.main"}}))
+	defer s.Close()
+
+	p, err := fetchSource(target + "/heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sample) != 1 || p.Sample[0].Value[0] != 10 {
+		t.Errorf("got samples %v, want one of 10", p.Sample)
+	}
+	for _, src := range []string{"file.pb.gz", "http://host:6060/heap", "https://host/heap"} {
+		if got := sourceURL(src); got != src {
+			t.Errorf("sourceURL(%q) = %q, want it unchanged", src, got)
+		}
+	}
+	if got, want := sourceURL("host:6060/heap"), "http://host:6060/heap"; got != want {
+		t.Errorf("sourceURL(host:6060/heap) = %q, want %q", got, want)
+	}
+}
+
+func TestCompareThreshold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i := 0; i < 5; i++ {
+		for set, v := range map[string]int64{"base": 100, "test": 200} {
+			p := testProfile(testSample{v + int64(i), []string{"main.a", "main.main"}})
+			f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s%d.pb.gz", set, i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Write(f); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+	}
+	base, test := filepath.Join(dir, "base*"), filepath.Join(dir, "test*")
+
+	err = compare([]string{"-base=" + base, "-test=" + test, "-threshold=50"})
+	if _, ok := err.(failure); !ok {
+		t.Errorf("compare over the threshold: got error %v, want a failure", err)
+	}
+	if err := compare([]string{"-base=" + base, "-test=" + test, "-threshold=200"}); err != nil {
+		t.Errorf("compare under the threshold: %v", err)
+	}
+	err = compare([]string{"-base=" + base, "-test=" + filepath.Join(dir, "missing.pb.gz")})
+	if _, ok := err.(failure); err == nil || ok {
+		t.Errorf("compare of a missing profile: got error %v, want an error other than a failure", err)
+	}
+}
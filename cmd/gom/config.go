@@ -0,0 +1,277 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui"
+)
+
+// config is the configuration of gom, read from a JSON file:
+//
+//	{
+//		"target": "staging",
+//		"refresh": "5s",
+//		"cpu_seconds": 10,
+//		"colors": {"help": "magenta", "cursor": "fg-black,bg-yellow"},
+//		"keys": {"C-r": ":r", "<f5>": ":c"},
+//		"targets": {"staging": "http://10.0.0.2:6060"},
+//		"alerts": ["goroutines > 10000", "heap growth > 20%/min"]
+//	}
+type config struct {
+	// Target is the default target, or the name of one of Targets.
+	Target string `json:"target"`
+
+	// Refresh is the interval between the refreshes of the stats and
+	// of the profile, e.g. 5s.
+	Refresh string `json:"refresh"`
+
+	// CPUSeconds is the duration of the CPU profiles, or zero for the
+	// default duration of the target.
+	CPUSeconds int `json:"cpu_seconds"`
+
+	Colors colors `json:"colors"`
+
+	// Keys binds keys to prompt commands, e.g. "C-r": ":r".
+	Keys map[string]string `json:"keys"`
+
+	// Targets names targets, to be used in place of their URLs.
+	Targets map[string]string `json:"targets"`
+
+	// Collector is the URL of a collector started with gom collect.
+	// The instances pushing to it can be named as service/instance in
+	// place of their URLs.
+	Collector string `json:"collector"`
+
+	// Alerts are alert rules on the stats of the target, e.g.
+	// "goroutines > 10000". AlertDir is the directory the profiles
+	// captured when they fire are saved in.
+	Alerts   []string `json:"alerts"`
+	AlertDir string   `json:"alert_dir"`
+
+	// ConfigToken is the token of the targets to change their
+	// profiling rates with :rate, as given to EnableConfig.
+	ConfigToken string `json:"config_token"`
+}
+
+// colors are the colors of the TUI. Widget colors are color names
+// such as blue; item colors are termui styles such as fg-white,bg-blue.
+type colors struct {
+	Help       string `json:"help"`
+	Sparklines string `json:"sparklines"`
+	Cursor     string `json:"cursor"` // the item under the cursor
+	Hot        string `json:"hot"`    // the hottest source lines
+	Warm       string `json:"warm"`   // the other source lines with samples
+}
+
+// conf is the configuration in use, defaults overridden by the config
+// file.
+var conf = config{
+	Refresh: "1s",
+	Colors: colors{
+		Help:       "blue",
+		Sparklines: "cyan",
+		Cursor:     "fg-white,bg-blue",
+		Hot:        "fg-red",
+		Warm:       "fg-yellow",
+	},
+}
+
+var colorNames = map[string]ui.Attribute{
+	"default": ui.ColorDefault,
+	"black":   ui.ColorBlack,
+	"red":     ui.ColorRed,
+	"green":   ui.ColorGreen,
+	"yellow":  ui.ColorYellow,
+	"blue":    ui.ColorBlue,
+	"magenta": ui.ColorMagenta,
+	"cyan":    ui.ColorCyan,
+	"white":   ui.ColorWhite,
+}
+
+// configDir returns the directory of the files of gom,
+// $XDG_CONFIG_HOME/gom or ~/.config/gom.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gom")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "gom")
+}
+
+// loadConfig reads the config file at path into conf. A missing file
+// is not an error.
+func loadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if _, err := refreshInterval(); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	for _, c := range []string{conf.Colors.Help, conf.Colors.Sparklines} {
+		if _, ok := colorNames[c]; !ok {
+			return fmt.Errorf("invalid config file %s: unknown color %q", path, c)
+		}
+	}
+	for _, a := range conf.Alerts {
+		if err := addAlert(a); err != nil {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// refreshInterval returns the interval between the refreshes.
+func refreshInterval() (time.Duration, error) {
+	d, err := time.ParseDuration(conf.Refresh)
+	if err != nil {
+		return 0, fmt.Errorf("invalid refresh interval: %v", err)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("refresh interval %v is shorter than 1s", d)
+	}
+	return d, nil
+}
+
+// resolveTarget returns the URL of the named target, or of the named
+// instance of the collector, or t itself if it names neither.
+func resolveTarget(t string) string {
+	if url, ok := conf.Targets[t]; ok {
+		return url
+	}
+	if conf.Collector != "" && !strings.Contains(t, "://") && strings.Count(t, "/") == 1 {
+		return conf.Collector + "/" + t
+	}
+	return t
+}
+
+// isFlagSet reports whether the named flag was set on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// session is the state of the TUI, saved with :save-session and
+// restored with :load-session.
+type session struct {
+	Profile     string          `json:"profile"`
+	SampleType  string          `json:"sample_type,omitempty"`
+	Cum         bool            `json:"cum"`
+	Granularity string          `json:"granularity"`
+	Filters     []sessionFilter `json:"filters,omitempty"`
+}
+
+type sessionFilter struct {
+	Kind string `json:"kind"`
+	Expr string `json:"expr"`
+}
+
+// sessionFile returns the file of the named session. Sessions are
+// named default unless a name is given.
+func sessionFile(name string) string {
+	if name == "" {
+		name = "default"
+	}
+	return filepath.Join(configDir(), "sessions", filepath.Base(name)+".json")
+}
+
+// saveSession saves the state of the TUI as the named session.
+func saveSession(name string) error {
+	s := session{
+		Profile:     currentProfile.name,
+		SampleType:  currentProfile.sampleType,
+		Cum:         cum,
+		Granularity: granularity,
+	}
+	for _, f := range filters {
+		s.Filters = append(s.Filters, sessionFilter{Kind: f.kind, Expr: f.expr})
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := sessionFile(name)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// loadSession restores the state of the TUI from the named session.
+func loadSession(name string) error {
+	data, err := ioutil.ReadFile(sessionFile(name))
+	if err != nil {
+		return err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid session: %v", err)
+	}
+	var fs []sampleFilter
+	for _, sf := range s.Filters {
+		f, err := newFilter(sf.Kind, sf.Expr)
+		if err != nil {
+			return err
+		}
+		fs = append(fs, f)
+	}
+	if !nameRx.MatchString(s.Profile) {
+		return fmt.Errorf("invalid session: invalid profile %q", s.Profile)
+	}
+	r, err := profileReport(s.Profile)
+	if err != nil {
+		return err
+	}
+	currentProfile = r
+	r.mu.Lock()
+	r.sampleType = s.SampleType
+	r.mu.Unlock()
+	cum = s.Cum
+	switch {
+	case s.Granularity == "":
+	case validGranularity(s.Granularity):
+		granularity = s.Granularity
+	default:
+		// Sessions may be edited by hand, or saved by other versions.
+		granularity = "functions"
+	}
+	filters = fs
+	list = ""
+	group = ""
+	peekHistory = nil
+	traceSummary = nil
+	growthView = false
+	leakView = false
+	topCursor = 0
+	reportPage = 0
+	return nil
+}
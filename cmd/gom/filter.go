@@ -0,0 +1,167 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/profile"
+)
+
+// A sampleFilter filters the samples of a profile by symbol names or
+// by labels.
+type sampleFilter struct {
+	kind string // focus, ignore, hide, tagfocus or tagignore
+	expr string
+
+	re  *regexp.Regexp   // for symbol name filters
+	tag profile.TagMatch // for label filters
+}
+
+// filterCommands maps the prompt commands adding filters to the kind
+// of the filters they add.
+var filterCommands = []struct {
+	prefix, kind string
+}{
+	{":f=", "focus"},
+	{":i=", "ignore"},
+	{":hide=", "hide"},
+	{":tf=", "tagfocus"},
+	{":ti=", "tagignore"},
+}
+
+// tagKeyRx matches the label filters of the form key=filter, which
+// only match the labels with the given key.
+var tagKeyRx = regexp.MustCompile(`^([[:word:].-]+)=(.*)$`)
+
+// newFilter compiles a filter of the given kind.
+func newFilter(kind, expr string) (sampleFilter, error) {
+	f := sampleFilter{kind: kind, expr: expr}
+	var err error
+	switch kind {
+	case "tagfocus", "tagignore":
+		var key string
+		if m := tagKeyRx.FindStringSubmatch(expr); m != nil {
+			key, expr = m[1], m[2]
+		}
+		f.tag, err = driver.TagFilter(key, expr)
+	default:
+		f.re, err = regexp.Compile(expr)
+	}
+	if err != nil {
+		return f, fmt.Errorf("invalid %s filter: %v", kind, err)
+	}
+	return f, nil
+}
+
+// apply applies the filter to p. It reports whether the filter
+// matched any sample.
+func (f sampleFilter) apply(p *profile.Profile) bool {
+	switch f.kind {
+	case "focus":
+		fm, _, _ := p.FilterSamplesByName(f.re, nil, nil)
+		return fm
+	case "ignore":
+		_, im, _ := p.FilterSamplesByName(nil, f.re, nil)
+		return im
+	case "hide":
+		_, _, hm := p.FilterSamplesByName(nil, nil, f.re)
+		return hm
+	case "tagfocus":
+		fm, _ := p.FilterSamplesByTag(f.tag, nil)
+		return fm
+	case "tagignore":
+		_, im := p.FilterSamplesByTag(nil, f.tag)
+		return im
+	}
+	return false
+}
+
+func (f sampleFilter) String() string {
+	return f.kind + "=" + f.expr
+}
+
+// applyFilters applies the filters to p in order. Each filter works on
+// the samples left by the previous ones. It returns the filters that
+// matched no samples, by index.
+func applyFilters(p *profile.Profile, filters []sampleFilter) (unmatched map[int]bool) {
+	unmatched = make(map[int]bool)
+	for i, f := range filters {
+		if !f.apply(p) {
+			unmatched[i] = true
+		}
+	}
+	return unmatched
+}
+
+// parseFilterCommand parses a prompt command adding a filter to the
+// filters. An empty regexp removes all the filters of its kind. It
+// reports whether cmd is a filter command.
+func parseFilterCommand(cmd string, filters []sampleFilter) ([]sampleFilter, bool, error) {
+	for _, c := range filterCommands {
+		if !strings.HasPrefix(cmd, c.prefix) {
+			continue
+		}
+		expr := strings.TrimPrefix(cmd, c.prefix)
+		if expr == "" {
+			var kept []sampleFilter
+			for _, f := range filters {
+				if f.kind != c.kind {
+					kept = append(kept, f)
+				}
+			}
+			return kept, true, nil
+		}
+		f, err := newFilter(c.kind, expr)
+		if err != nil {
+			return filters, true, err
+		}
+		return append(filters, f), true, nil
+	}
+	return filters, false, nil
+}
+
+// removeFilter removes the nth filter, counting from 1, or all the
+// filters if arg is empty.
+func removeFilter(arg string, filters []sampleFilter) ([]sampleFilter, error) {
+	if arg == "" {
+		return nil, nil
+	}
+	var n int
+	if _, err := fmt.Sscanf(arg, "%d", &n); err != nil || n < 1 || n > len(filters) {
+		return filters, fmt.Errorf("no filter %s", arg)
+	}
+	return append(filters[:n-1:n-1], filters[n:]...), nil
+}
+
+// filterStatus describes the active filters, marking the ones that
+// matched no samples.
+func filterStatus(filters []sampleFilter, unmatched map[int]bool) string {
+	if len(filters) == 0 {
+		return "no filters"
+	}
+	var s []string
+	for i, f := range filters {
+		item := fmt.Sprintf("%d:%v", i+1, f)
+		if unmatched[i] {
+			item = fmt.Sprintf("[%s (no match)](fg-red)", item)
+		}
+		s = append(s, item)
+	}
+	return "filters: " + strings.Join(s, "  ")
+}
@@ -20,34 +20,118 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	ui "github.com/gizak/termui"
+	"github.com/rakyll/gom/internal/driver"
+	goreport "github.com/rakyll/gom/internal/report"
 )
 
 var (
-	target = flag.String("target", "http://localhost:6060", "the target process to profile; it has to enable pprof debug server")
+	target      = flag.String("target", "http://localhost:6060", "the target process to profile; it has to enable pprof debug server")
+	httpAddr    = flag.String("http", "", "serve a web UI on the given address, e.g. :8080, instead of the terminal UI")
+	sourcePaths = flag.String("source_path", "", "comma-separated list of rules to locate source files: from=to, gomod:path/to/go.mod or vendor:path/to/vendor")
+	configFile  = flag.String("config", filepath.Join(configDir(), "config"), "the config file")
 
 	prompt  *ui.Par
 	ls      *ui.List
 	sp      *ui.Sparklines
 	display *ui.Par
+	status  *ui.Par
+	detail  *ui.Par
 
 	cpuProfile     = &report{name: "profile"}
 	heapProfile    = &report{name: "heap"}
 	currentProfile = heapProfile
 
+	// input is the line typed in the prompt, and promptMsg is the
+	// command being handled.
+	input     lineEditor
 	promptMsg string
 
+	// statsErr is set while the message displayed is an error fetching
+	// the stats, to clear it once the stats are back.
+	statsErr bool
+
 	reportPage  int
 	reportItems []string
 	cum         bool
-	filter      string
+	granularity = "functions"
+	filters     []sampleFilter
+
+	// list is the regexp of the functions to list the source of.
+	// If empty, the top entries of the profile are listed.
+	list string
+
+	// group is the key of the label to break down the profile by.
+	// If empty, the profile is not broken down.
+	group string
+
+	pathRules []goreport.PathRule
 )
 
+// subcommands are run instead of the TUI when named as the first
+// argument.
+var subcommands = map[string]func(args []string) error{
+	"pprof":    pprof,
+	"snapshot": snapshot,
+	"collect":  collect,
+	"compare":  compare,
+	"check":    check,
+	"bench":    bench,
+}
+
+// A failure is the error of a subcommand that ran but found a problem,
+// such as violated rules. Subcommands exit with status 1 on failures,
+// and 2 on other errors.
+type failure struct {
+	error
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := loadConfig(*configFile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				if _, ok := err.(failure); ok {
+					os.Exit(1)
+				}
+				os.Exit(2)
+			}
+			return
+		}
+	}
 	flag.Parse()
+	if err := loadConfig(*configFile); err != nil {
+		log.Fatal(err)
+	}
+	if !isFlagSet(flag.CommandLine, "target") && conf.Target != "" {
+		*target = conf.Target
+	}
+	*target = resolveTarget(*target)
+	rules, err := sourcePathRules(*sourcePaths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pathRules = rules
+	if *httpAddr != "" {
+		log.Fatal(serveWeb(*httpAddr))
+	}
+	runTUI()
+}
+
+// runTUI runs the terminal UI until it is quit.
+func runTUI() {
+	input.loadHistory(historyFile())
 	if err := ui.Init(); err != nil {
 		panic(err)
 	}
@@ -55,39 +139,72 @@ func main() {
 	draw()
 	ui.Handle("/sys/kbd", func(e ui.Event) {
 		ev := e.Data.(ui.EvtKbd)
-		switch ev.KeyStr {
-		case ":":
-			// TODO(jbd): enable input mode and disable after esc or enter.
-			promptMsg = ":"
-		case "C-8":
-			if l := len(promptMsg); l != 0 {
-				promptMsg = promptMsg[:l-1]
+		if input.empty() {
+			if cmd, ok := conf.Keys[ev.KeyStr]; ok {
+				runCommand(cmd)
+				refresh()
+				return
 			}
-		case "<enter>":
-			handleInput()
-			promptMsg = ""
-		case "<up>":
-			if reportPage > 0 {
-				reportPage--
+			if handleNavigation(ev.KeyStr) || handleSelection(ev.KeyStr) || scrollBenchPane(ev.KeyStr) {
+				refresh()
+				return
 			}
-		case "<down>":
-			reportPage++
+		}
+		switch ev.KeyStr {
+		case "<enter>":
+			cmd := input.String()
+			input.addHistory(cmd, historyFile())
+			input.reset()
+			runCommand(cmd)
 		case "<escape>":
-			promptMsg = ""
+			input.reset()
+		case "<tab>", "C-i":
+			input.complete(promptCompleter())
 		default:
-			// TODO: filter irrelevant keys such as up, down, etc.
-			promptMsg += ev.KeyStr
+			input.handleKey(ev.KeyStr)
 		}
 		refresh()
 	})
 	ui.Handle("/sys/kbd/C-c", func(ui.Event) {
 		ui.StopLoop()
 	})
-	ui.Handle("/timer/1s", func(ui.Event) {
-		loadProfile(false)
-		loadStats()
+	ui.Merge("trace", traceDone)
+	ui.Handle("/gom/trace", func(e ui.Event) {
+		showTrace(e.Data.(traceResult))
 		refresh()
 	})
+	ui.Merge("heap", heapDone)
+	ui.Handle("/gom/heap", func(e ui.Event) {
+		addHeapSnapshot(e.Data.(heapResult))
+		refresh()
+	})
+	ui.Merge("goroutines", goroutinesDone)
+	ui.Handle("/gom/goroutines", func(e ui.Event) {
+		addGoroutineSnapshot(e.Data.(goroutinesResult))
+		refresh()
+	})
+	ui.Merge("alert", alertDone)
+	ui.Handle("/gom/alert", func(e ui.Event) {
+		showAlert(e.Data.(alertResult))
+		refresh()
+	})
+	if benchProfiles != nil {
+		// The profiles of benchmarks do not change.
+		loadProfile(false)
+		refresh()
+	} else {
+		interval, _ := refreshInterval()
+		if interval != time.Second {
+			ui.Merge("refresh", ui.NewTimerCh(interval))
+		}
+		ui.Handle("/timer/"+interval.String(), func(ui.Event) {
+			captureHeap(time.Now())
+			captureGoroutines(time.Now())
+			loadProfile(false)
+			loadStats()
+			refresh()
+		})
+	}
 	ui.Handle("/sys/wnd/resize", func(e ui.Event) {
 		ui.Body.Width = ui.TermWidth()
 		refresh()
@@ -103,78 +220,206 @@ func draw() {
 	display.Height = 1
 	display.Border = false
 
-	prompt = ui.NewPar(promptMsg)
+	prompt = ui.NewPar("")
 	prompt.Height = 1
 	prompt.Border = false
 
-	help := ui.NewPar(`:c, :h for profiles; :f to filter; ↓ and ↑ to paginate`)
+	status = ui.NewPar("")
+	status.Height = 1
+	status.Border = false
+
+	detail = ui.NewPar("")
+	detail.Height = 7
+	detail.BorderLabel = "f focus, i ignore, p peek, l list"
+
+	help := ui.NewPar(`:c, :h, :p for profiles; :f, :i, :hide, :tf, :ti to filter; :l to list source; :peek for callers and callees; :v to select the sample type; :g for granularity; :group to break down by label; :t to trace; :growth for heap growth; :leaks for goroutine leaks; :target to switch targets; :alert to watch the stats; :rate for sampling rates; :save-session, :load-session; tab to complete; ↓ and ↑ to select or paginate`)
 	help.Height = 1
 	help.Border = false
-	help.TextBgColor = ui.ColorBlue
-	help.Bg = ui.ColorBlue
+	help.TextBgColor = colorNames[conf.Colors.Help]
+	help.Bg = colorNames[conf.Colors.Help]
 	help.TextFgColor = ui.ColorWhite
 
 	gs := ui.Sparkline{}
 	gs.Title = "goroutines"
-	gs.Height = 4
-	gs.LineColor = ui.ColorCyan
+	gs.Height = 2
+	gs.LineColor = colorNames[conf.Colors.Sparklines]
 
 	ts := ui.Sparkline{}
 	ts.Title = "threads"
-	ts.Height = 4
-	ts.LineColor = ui.ColorCyan
+	ts.Height = 2
+	ts.LineColor = colorNames[conf.Colors.Sparklines]
+
+	hs := ui.Sparkline{}
+	hs.Title = "heap"
+	hs.Height = 2
+	hs.LineColor = colorNames[conf.Colors.Sparklines]
 
-	sp = ui.NewSparklines(gs, ts)
+	sp = ui.NewSparklines(gs, ts, hs)
 	sp.Height = 10
 	sp.Border = false
 
+	// The results of benchmarks are shown in place of the stats.
+	var top ui.GridBufferer = sp
+	if benchResults != nil {
+		benchPane = ui.NewPar("")
+		layoutBenchPane()
+		top = benchPane
+	}
+
 	ls = ui.NewList()
 	ls.Border = false
 	ui.Body.AddRows(
 		ui.NewRow(ui.NewCol(4, 0, prompt), ui.NewCol(8, 0, help)),
-		ui.NewRow(ui.NewCol(12, 0, sp)),
+		ui.NewRow(ui.NewCol(12, 0, top)),
 		ui.NewRow(ui.NewCol(12, 0, display)),
+		ui.NewRow(ui.NewCol(12, 0, status)),
 		ui.NewRow(ui.NewCol(12, 0, ls)),
+		ui.NewRow(ui.NewCol(12, 0, detail)),
 	)
 }
 
 func loadStats() {
 	var max = ui.TermWidth()
-	s, err := fetchStats()
+	s, err := fetchStats(*target)
 	if err != nil {
 		displayMsg(fmt.Sprintf("error fetching stats: %v", err))
+		statsErr = true
 		return
 	}
-	displayMsg("")
+	if statsErr {
+		displayMsg("")
+		statsErr = false
+	}
+	now := time.Now()
+	fired := observeStats(now, s)
+	firing := firingMetrics()
+	heap, unit := goreport.ScaleValue(int64(s.HeapAlloc), "bytes", "minimum")
 	var cnts = []struct {
-		cnt      int
-		titleFmt string
+		metric string
+		cnt    int
+		title  string
 	}{
-		{s.Goroutine, "goroutines (%d)"},
-		{s.Thread, "threads (%d)"},
+		{"goroutines", s.Goroutine, fmt.Sprintf("goroutines (%d)", s.Goroutine)},
+		{"threads", s.Thread, fmt.Sprintf("threads (%d)", s.Thread)},
+		{"heap", int(s.HeapAlloc), fmt.Sprintf("heap (%.1f%s)", heap, unit)},
 	}
 	for i, v := range cnts {
 		if n := len(sp.Lines[i].Data); n > max {
 			sp.Lines[i].Data = sp.Lines[i].Data[n-max : n]
 		}
-		sp.Lines[i].Title = fmt.Sprintf(v.titleFmt, v.cnt)
+		sp.Lines[i].Title = v.title
 		sp.Lines[i].Data = append(sp.Lines[i].Data, v.cnt)
+		sp.Lines[i].LineColor = colorNames[conf.Colors.Sparklines]
+		if firing[v.metric] {
+			sp.Lines[i].LineColor = ui.ColorRed
+			sp.Lines[i].Title += " ALERT"
+		}
+	}
+	if len(fired) > 0 {
+		alert(now, fired)
+	}
+}
+
+// alert rings the bell and captures the profiles of the target in the
+// background when rules start firing. The files saved are shown by
+// showAlert once captured.
+func alert(t time.Time, fired []*alertRule) {
+	fmt.Print("\a")
+	var rules []string
+	for _, r := range fired {
+		rules = append(rules, r.text)
+	}
+	msg := "alert: " + strings.Join(rules, ", ")
+	displayMsg(fmt.Sprintf("[%s; capturing profiles...](fg-red)", msg))
+	startAlertCapture(*target, t, msg)
+}
+
+// showAlert shows the profiles captured by alert.
+func showAlert(r alertResult) {
+	msg := r.msg
+	if r.err != nil {
+		msg += fmt.Sprintf("; error capturing profiles: %v", r.err)
 	}
+	if len(r.files) > 0 {
+		msg += "; saved " + strings.Join(r.files, ", ")
+	}
+	displayMsg(fmt.Sprintf("[%s](fg-red)", msg))
 }
 
 func loadProfile(force bool) {
-	if err := currentProfile.fetch(force, 0); err != nil {
+	if traceSummary != nil {
+		selected, selectedDetail = nil, ""
+		status.Text = "[execution trace](fg-bold)  :c or :h to go back to the profiles"
+		reportItems = traceSummary
+		return
+	}
+	if growthView {
+		selected, selectedDetail = nil, ""
+		status.Text = fmt.Sprintf("[heap growth](fg-bold) by %s  %s  :growth off to stop, :c or :h to go back", granularity, filterStatus(filters, nil))
+		reportItems = growthReport(heapSnapshots, granularity, filters)
+		return
+	}
+	if leakView {
+		selected, selectedDetail = nil, ""
+		status.Text = "[goroutine leaks](fg-bold)  :leaks off to stop, :c or :h to go back"
+		reportItems = leakReport(goroutineSnapshots)
+		return
+	}
+	var seconds int
+	if currentProfile == cpuProfile {
+		seconds = conf.CPUSeconds
+	}
+	if err := currentProfile.fetch(force, seconds); err != nil {
+		displayMsg(err.Error())
+		return
+	}
+	p, unmatched := currentProfile.filtered(filters)
+	if p == nil {
+		return
+	}
+	selected, selectedDetail = nil, ""
+	stype := currentProfile.sampleType
+	_, t, unit, err := driver.SampleValue(p, stype)
+	if err != nil {
 		displayMsg(err.Error())
 		return
 	}
-	re, _ := regexp.Compile(filter)
-	reportItems = currentProfile.filter(cum, re)
+	status.Text = fmt.Sprintf("[%s (%s)](fg-bold) by %s  %s", t, unit, granularity, filterStatus(filters, unmatched))
+	if group != "" {
+		reportItems = labels(p, stype, group)
+		return
+	}
+	if len(peekHistory) > 0 {
+		var cursor int
+		reportItems, cursor = peek(p, stype, granularity)
+		reportPage = cursor / pageSize()
+		return
+	}
+	if list != "" {
+		symbol, err := regexp.Compile(list)
+		if err != nil {
+			displayMsg(fmt.Sprintf("invalid list regexp: %v", err))
+			return
+		}
+		reportItems = source(p, stype, symbol, pathRules)
+		return
+	}
+	var cursor int
+	reportItems, cursor = top(p, stype, granularity, cum)
+	reportPage = cursor / pageSize()
 }
 
 func refresh() {
-	prompt.Text = promptMsg
+	prompt.Text = ""
+	if !input.empty() {
+		prompt.Text = input.render()
+	}
+	detail.Text = selectedDetail
+	if benchPane != nil {
+		layoutBenchPane()
+	}
 
-	nreport := ui.TermHeight() - 13
+	nreport := pageSize()
 	ls.Height = nreport
 	if len(reportItems) > nreport*reportPage {
 		// can seek to the page
@@ -187,37 +432,494 @@ func refresh() {
 	ui.Render(ui.Body)
 }
 
+// pageSize returns the number of report items shown at once.
+func pageSize() int {
+	top := sp.Height
+	if benchPane != nil {
+		top = benchPane.Height
+	}
+	return ui.TermHeight() - 4 - top - detail.Height
+}
+
+// handleNavigation moves over the report with the key, while the
+// prompt is empty. It reports whether key is a navigation key.
+func handleNavigation(key string) bool {
+	switch key {
+	case "<up>":
+		moveCursor(-1)
+	case "<down>":
+		moveCursor(1)
+	case "<previous>":
+		moveCursor(-pageSize())
+	case "<next>":
+		moveCursor(pageSize())
+	case "C-8", "<backspace>":
+		if len(peekHistory) > 0 && backPeek() {
+			loadProfile(false)
+		}
+	case "<enter>":
+		if len(peekHistory) == 0 {
+			return false
+		}
+		recenterPeek()
+		loadProfile(false)
+	default:
+		return false
+	}
+	return true
+}
+
+// moveCursor moves the cursor of the top and the peek views by delta.
+// Other views are paginated.
+func moveCursor(delta int) {
+	switch {
+	case len(peekHistory) > 0:
+		movePeekCursor(delta)
+		loadProfile(false)
+	case list == "" && group == "" && traceSummary == nil && !growthView && !leakView:
+		moveTopCursor(delta)
+		loadProfile(false)
+	case delta < 0 && reportPage > 0:
+		reportPage--
+	case delta > 0:
+		reportPage++
+	}
+}
+
+// runCommand handles the prompt command cmd.
+func runCommand(cmd string) {
+	promptMsg = cmd
+	handleInput()
+	promptMsg = ""
+}
+
 func handleInput() {
 	// TODO(jbd): disable input when handling input.
+	displayMsg("")
+	if needsTarget(promptMsg) {
+		displayMsg(fmt.Sprintf("%s needs a target, it is not available for benchmarks", strings.Fields(promptMsg)[0]))
+		refresh()
+		return
+	}
 	switch promptMsg {
 	case ":c":
-		currentProfile = cpuProfile
-		reportPage = 0
-		filter = ""
-		loadProfile(false)
+		openProfile(cpuProfile)
 	case ":h":
-		currentProfile = heapProfile
-		reportPage = 0
-		filter = ""
-		loadProfile(false)
+		openProfile(heapProfile)
 	case ":r":
 		reportPage = 0
 		loadProfile(true)
 	case ":s":
 		cum = !cum
 		reportPage = 0
+		topCursor = 0
 		loadProfile(false)
 	}
 	// handle filtering
-	if strings.HasPrefix(promptMsg, ":f=") {
-		re := regexp.MustCompile(":f=(.*)")
-		filter = re.FindStringSubmatch(promptMsg)[1]
+	if fs, ok, err := parseFilterCommand(promptMsg, filters); ok {
+		if err != nil {
+			displayMsg(err.Error())
+		}
+		filters = fs
+		reportPage = 0
+		topCursor = 0
+		loadProfile(false)
+	}
+	if promptMsg == ":rm" || strings.HasPrefix(promptMsg, ":rm ") {
+		fs, err := removeFilter(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":rm")), filters)
+		if err != nil {
+			displayMsg(err.Error())
+		}
+		filters = fs
+		reportPage = 0
+		topCursor = 0
+		loadProfile(false)
+	}
+	// handle source listing
+	if promptMsg == ":l" || strings.HasPrefix(promptMsg, ":l ") {
+		list = strings.TrimSpace(strings.TrimPrefix(promptMsg, ":l"))
+		group = ""
+		peekHistory = nil
+		traceSummary = nil
+		growthView = false
+		leakView = false
+		reportPage = 0
+		loadProfile(false)
+	}
+	// handle sample type selection
+	if promptMsg == ":v" || strings.HasPrefix(promptMsg, ":v ") {
+		selectSampleType(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":v")))
+		reportPage = 0
+		topCursor = 0
+		loadProfile(false)
+	}
+	// handle granularity selection
+	if promptMsg == ":g" || strings.HasPrefix(promptMsg, ":g ") {
+		selectGranularity(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":g")))
 		reportPage = 0
+		topCursor = 0
+		loadProfile(false)
+	}
+	// handle the peek view
+	if promptMsg == ":peek" || strings.HasPrefix(promptMsg, ":peek ") {
+		handlePeek(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":peek")))
+		reportPage = 0
+		loadProfile(false)
+	}
+	// handle grouping by label
+	if promptMsg == ":group" || strings.HasPrefix(promptMsg, ":group ") {
+		group = strings.TrimSpace(strings.TrimPrefix(promptMsg, ":group"))
+		list = ""
+		peekHistory = nil
+		traceSummary = nil
+		growthView = false
+		leakView = false
+		reportPage = 0
+		loadProfile(false)
+	}
+	// handle execution traces
+	if promptMsg == ":t" || strings.HasPrefix(promptMsg, ":t ") {
+		handleTrace(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":t")))
+		reportPage = 0
+		loadProfile(false)
+	}
+	// handle the heap growth view
+	if promptMsg == ":growth" || strings.HasPrefix(promptMsg, ":growth ") {
+		handleGrowth(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":growth")))
+		reportPage = 0
+		loadProfile(false)
+	}
+	// handle the goroutine leak view
+	if promptMsg == ":leaks" || strings.HasPrefix(promptMsg, ":leaks ") {
+		handleLeaks(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":leaks")))
+		reportPage = 0
+		loadProfile(false)
+	}
+	// handle the profiling rates
+	if promptMsg == ":rate" || strings.HasPrefix(promptMsg, ":rate ") {
+		handleRate(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":rate")))
+	}
+	// handle target switching
+	if promptMsg == ":p" {
+		listProfiles()
+	} else if strings.HasPrefix(promptMsg, ":p ") {
+		name := strings.TrimSpace(strings.TrimPrefix(promptMsg, ":p"))
+		if r, err := profileReport(name); err != nil {
+			displayMsg(err.Error())
+		} else {
+			openProfile(r)
+		}
+	}
+	if promptMsg == ":target" {
+		displayMsg("target: " + *target)
+	} else if strings.HasPrefix(promptMsg, ":target ") {
+		switchTarget(resolveTarget(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":target"))))
+		loadProfile(false)
+		loadStats()
+	}
+	if promptMsg == ":instances" {
+		listInstances()
+	}
+	// handle alerts
+	if promptMsg == ":alert" {
+		displayMsg(listAlerts())
+	} else if promptMsg == ":alert off" {
+		alertRules = nil
+	} else if strings.HasPrefix(promptMsg, ":alert ") {
+		if err := addAlert(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":alert"))); err != nil {
+			displayMsg(err.Error())
+		}
+	}
+	// handle sessions
+	if promptMsg == ":save-session" || strings.HasPrefix(promptMsg, ":save-session ") {
+		name := strings.TrimSpace(strings.TrimPrefix(promptMsg, ":save-session"))
+		if err := saveSession(name); err != nil {
+			displayMsg(fmt.Sprintf("error saving session: %v", err))
+		} else {
+			displayMsg("saved session to " + sessionFile(name))
+		}
+	}
+	if promptMsg == ":load-session" || strings.HasPrefix(promptMsg, ":load-session ") {
+		if err := loadSession(strings.TrimSpace(strings.TrimPrefix(promptMsg, ":load-session"))); err != nil {
+			displayMsg(fmt.Sprintf("error loading session: %v", err))
+		}
 		loadProfile(false)
 	}
 	refresh()
 }
 
+// openProfile shows the profile r, dropping the filters and the views
+// of the previous one.
+func openProfile(r *report) {
+	currentProfile = r
+	reportPage = 0
+	topCursor = 0
+	filters = nil
+	list = ""
+	group = ""
+	peekHistory = nil
+	traceSummary = nil
+	growthView = false
+	leakView = false
+	loadProfile(false)
+}
+
+// listProfiles lists the profiles of the target, with their counts.
+func listProfiles() {
+	if benchProfiles != nil {
+		displayMsg("profiles: " + strings.Join(benchProfileNames(), ", "))
+		return
+	}
+	l, err := fetchProfileList(*target)
+	if err != nil {
+		displayMsg(fmt.Sprintf("error listing the profiles: %v", err))
+		return
+	}
+	var names []string
+	for _, p := range l {
+		if p.Count != nil {
+			names = append(names, fmt.Sprintf("%s (%d)", p.Name, *p.Count))
+		} else {
+			names = append(names, p.Name)
+		}
+	}
+	displayMsg("profiles: " + strings.Join(names, ", "))
+}
+
+// handleTrace captures an execution trace for the given number of
+// seconds, 5 by default, in the background. Its summary is shown by
+// showTrace once captured.
+func handleTrace(arg string) {
+	seconds := 5
+	if arg != "" {
+		if _, err := fmt.Sscanf(arg, "%d", &seconds); err != nil || seconds < 1 {
+			displayMsg(fmt.Sprintf("invalid trace duration %s", arg))
+			return
+		}
+	}
+	if traceCapturing {
+		displayMsg("a trace is already being captured")
+		return
+	}
+	displayMsg(fmt.Sprintf("capturing an execution trace for %ds...", seconds))
+	startTrace(*target, seconds)
+}
+
+// showTrace shows the summary of a trace captured by handleTrace.
+func showTrace(r traceResult) {
+	traceCapturing = false
+	if r.target != *target {
+		return
+	}
+	if r.err != nil {
+		displayMsg(fmt.Sprintf("error capturing the trace: %v", r.err))
+		return
+	}
+	displayMsg("")
+	traceSummary = r.summary
+	growthView = false
+	leakView = false
+	peekHistory = nil
+	list = ""
+	group = ""
+	reportPage = 0
+	loadProfile(false)
+}
+
+// handleGrowth shows the growth of the heap, capturing the heap profile
+// at the given interval, 30s by default. If arg is off, the captures
+// are stopped.
+func handleGrowth(arg string) {
+	if arg == "off" {
+		growthInterval = 0
+		heapSnapshots = nil
+		growthView = false
+		return
+	}
+	d := 30 * time.Second
+	if arg != "" {
+		var err error
+		if d, err = time.ParseDuration(arg); err != nil || d < time.Second {
+			displayMsg(fmt.Sprintf("invalid capture interval %s", arg))
+			return
+		}
+	}
+	if arg != "" || growthInterval == 0 {
+		growthInterval = d
+		heapSnapshots = nil
+	}
+	captureHeap(time.Now())
+	traceSummary = nil
+	leakView = false
+	peekHistory = nil
+	list = ""
+	group = ""
+	growthView = true
+}
+
+// handleLeaks shows the stacks whose goroutines keep growing, dumping
+// the goroutines at the given interval, 30s by default. If arg is off,
+// the dumps are stopped.
+func handleLeaks(arg string) {
+	if arg == "off" {
+		leakInterval = 0
+		goroutineSnapshots = nil
+		leakView = false
+		return
+	}
+	d := 30 * time.Second
+	if arg != "" {
+		var err error
+		if d, err = time.ParseDuration(arg); err != nil || d < time.Second {
+			displayMsg(fmt.Sprintf("invalid dump interval %s", arg))
+			return
+		}
+	}
+	if arg != "" || leakInterval == 0 {
+		leakInterval = d
+		goroutineSnapshots = nil
+	}
+	captureGoroutines(time.Now())
+	traceSummary = nil
+	growthView = false
+	peekHistory = nil
+	list = ""
+	group = ""
+	leakView = true
+}
+
+// switchTarget switches to the target t, dropping the profiles and the
+// stats of the previous one.
+func switchTarget(t string) {
+	*target = t
+	profilesMu.Lock()
+	for _, r := range profiles {
+		r.mu.Lock()
+		r.p = nil
+		r.sampleType = ""
+		r.mu.Unlock()
+	}
+	profilesMu.Unlock()
+	for i := range sp.Lines {
+		sp.Lines[i].Data = nil
+	}
+	statsHistory = nil
+	heapSnapshots = nil
+	goroutineSnapshots = nil
+	for _, r := range alertRules {
+		r.firing = false
+	}
+	peekHistory = nil
+	traceSummary = nil
+	growthView = false
+	leakView = false
+	topCursor = 0
+	reportPage = 0
+	displayMsg("target: " + t)
+}
+
+// listInstances lists the instances pushing to the collector.
+func listInstances() {
+	if conf.Collector == "" {
+		displayMsg("no collector in the config file")
+		return
+	}
+	names, err := fetchInstances(conf.Collector)
+	if err != nil {
+		displayMsg(fmt.Sprintf("error listing the instances: %v", err))
+		return
+	}
+	if len(names) == 0 {
+		displayMsg("no instances")
+		return
+	}
+	displayMsg("instances: " + strings.Join(names, ", "))
+}
+
+// handlePeek centers the peek view on the heaviest function matching
+// the regexp expr. If expr is empty, the peek view is closed.
+func handlePeek(expr string) {
+	peekHistory = nil
+	if expr == "" {
+		return
+	}
+	rx, err := regexp.Compile(expr)
+	if err != nil {
+		displayMsg(fmt.Sprintf("invalid peek regexp: %v", err))
+		return
+	}
+	p, _ := currentProfile.filtered(filters)
+	if p == nil {
+		return
+	}
+	if err := startPeek(p, currentProfile.sampleType, granularity, rx); err != nil {
+		displayMsg(err.Error())
+		return
+	}
+	list = ""
+	group = ""
+	traceSummary = nil
+	growthView = false
+	leakView = false
+}
+
+// selectSampleType selects the sample type of the current profile to
+// report. If t is empty, it lists the sample types of the profile.
+func selectSampleType(t string) {
+	types := currentProfile.sampleTypes()
+	if t == "" {
+		displayMsg("sample types: " + strings.Join(types, ", "))
+		return
+	}
+	for _, st := range types {
+		if st == t {
+			// The web view reads the sample type.
+			currentProfile.mu.Lock()
+			currentProfile.sampleType = t
+			currentProfile.mu.Unlock()
+			return
+		}
+	}
+	displayMsg(fmt.Sprintf("unknown sample type %s; sample types: %s", t, strings.Join(types, ", ")))
+}
+
+// selectGranularity selects the granularity of the top list. If g is
+// empty, it lists the granularities.
+func selectGranularity(g string) {
+	if validGranularity(g) {
+		granularity = g
+		return
+	}
+	displayMsg("granularities: " + strings.Join(driver.Granularities, ", "))
+}
+
+// validGranularity reports whether g is one of driver.Granularities.
+func validGranularity(g string) bool {
+	for _, gr := range driver.Granularities {
+		if gr == g {
+			return true
+		}
+	}
+	return false
+}
+
+// sourcePathRules parses the -source_path rules. Unless a go.mod file
+// is given, the go.mod file in the working directory is used to
+// locate module sources.
+func sourcePathRules(s string) ([]goreport.PathRule, error) {
+	rules, err := goreport.ParsePathRules(s)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(s, "gomod:") {
+		return rules, nil
+	}
+	if rule, err := goreport.ModuleRule("go.mod"); err == nil {
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
 func displayMsg(msg string) {
 	// TODO(jbd): hide after n secs.
 	display.Text = msg
@@ -0,0 +1,259 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	ui "github.com/gizak/termui"
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// maxHeapSnapshots is the number of heap profiles kept to analyze the
+// growth of the heap.
+const maxHeapSnapshots = 30
+
+var (
+	// growthView is set while the heap growth view is shown.
+	growthView bool
+
+	// growthInterval is the interval between the captures of the heap
+	// profile, or zero if the heap profile is not captured.
+	growthInterval time.Duration
+
+	// heapSnapshots are the heap profiles captured, oldest first.
+	heapSnapshots []heapSnapshot
+
+	// heapCapturing is set while a heap profile is captured.
+	heapCapturing bool
+)
+
+// heapDone receives the heap profiles captured, off the UI goroutine,
+// as heapResult events.
+var heapDone = make(chan ui.Event)
+
+// A heapResult is the outcome of the capture of a heap profile of
+// target.
+type heapResult struct {
+	target string
+	snap   heapSnapshot
+	err    error
+}
+
+// A heapSnapshot is a heap profile captured at a given time.
+type heapSnapshot struct {
+	t time.Time
+	p *profile.Profile
+}
+
+// captureHeap captures the heap profile of the target in the
+// background if the growth interval has elapsed since the last
+// capture, and sends it to heapDone.
+func captureHeap(now time.Time) {
+	if growthInterval == 0 || heapCapturing {
+		return
+	}
+	if n := len(heapSnapshots); n > 0 && now.Sub(heapSnapshots[n-1].t) < growthInterval {
+		return
+	}
+	heapCapturing = true
+	target := *target
+	go func() {
+		p, err := fetchProfile(target, "heap", 0)
+		heapDone <- ui.Event{Path: "/gom/heap", Data: heapResult{target, heapSnapshot{t: now, p: p}, err}}
+	}()
+}
+
+// addHeapSnapshot keeps the heap profile captured by captureHeap, if
+// still captured for the current target.
+func addHeapSnapshot(r heapResult) {
+	heapCapturing = false
+	if r.target != *target || growthInterval == 0 {
+		return
+	}
+	if r.err != nil {
+		displayMsg(fmt.Sprintf("error capturing the heap profile: %v", r.err))
+		return
+	}
+	heapSnapshots = append(heapSnapshots, r.snap)
+	if n := len(heapSnapshots); n > maxHeapSnapshots {
+		heapSnapshots = heapSnapshots[n-maxHeapSnapshots:]
+	}
+	if growthView {
+		loadProfile(false)
+	}
+}
+
+// A growthSite is a call site allocating heap memory.
+type growthSite struct {
+	name string
+
+	// growth is the growth of the memory in use by the site and
+	// alloc the memory it allocated, between the first and the last
+	// snapshots.
+	growth, alloc int64
+
+	// inuse is the memory in use by the site in each snapshot.
+	inuse []int64
+}
+
+type growthSites []*growthSite
+
+func (s growthSites) Len() int      { return len(s) }
+func (s growthSites) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s growthSites) Less(i, j int) bool {
+	if s[i].growth != s[j].growth {
+		return s[i].growth > s[j].growth
+	}
+	return s[i].name < s[j].name
+}
+
+// growth lists the call sites of the heap snapshots at the given
+// granularity, by decreasing growth of their memory in use. The growth
+// and the allocations of the sites are taken from the difference of the
+// last and the first snapshots.
+func growth(snapshots []heapSnapshot, granularity string, filters []sampleFilter) (growthSites, error) {
+	first, last := snapshots[0].p, snapshots[len(snapshots)-1].p
+	delta := last.Copy()
+	if err := delta.Merge(first, -1); err != nil {
+		return nil, err
+	}
+	sites := make(map[string]*growthSite)
+	site := func(name string) *growthSite {
+		s, ok := sites[name]
+		if !ok {
+			s = &growthSite{name: name, inuse: make([]int64, len(snapshots))}
+			sites[name] = s
+		}
+		return s
+	}
+	inuse, err := siteValues(delta, "inuse_space", granularity, filters)
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range inuse {
+		site(name).growth = v
+	}
+	// Heap profiles read with no allocation sample types have no
+	// allocations to report.
+	if alloc, err := siteValues(delta, "alloc_space", granularity, filters); err == nil {
+		for name, v := range alloc {
+			site(name).alloc = v
+		}
+	}
+	for i, snap := range snapshots {
+		values, err := siteValues(snap.p, "inuse_space", granularity, filters)
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range values {
+			site(name).inuse[i] = v
+		}
+	}
+
+	var l growthSites
+	for _, s := range sites {
+		l = append(l, s)
+	}
+	sort.Sort(l)
+	return l, nil
+}
+
+// siteValues returns the flat values of the sample type stype of a
+// copy of p, by call site at the given granularity.
+func siteValues(p *profile.Profile, stype, granularity string, filters []sampleFilter) (map[string]int64, error) {
+	p = p.Copy()
+	applyFilters(p, filters)
+	if err := driver.Aggregate(p, granularity); err != nil {
+		return nil, err
+	}
+	rpt, err := newReport(p, stype, goreport.Options{})
+	if err != nil {
+		return nil, err
+	}
+	t, err := goreport.NewTable(rpt)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]int64)
+	for _, r := range t.Rows {
+		if r.Flat != 0 {
+			values[r.Name] = r.Flat
+		}
+	}
+	return values, nil
+}
+
+// growthReport lists the call sites with the fastest growing memory in
+// use, with their allocation rates and the trend of their memory in use
+// over the snapshots.
+func growthReport(snapshots []heapSnapshot, granularity string, filters []sampleFilter) []string {
+	if len(snapshots) < 2 {
+		return []string{fmt.Sprintf("capturing the heap profile every %v, waiting for a second capture...", growthInterval)}
+	}
+	sites, err := growth(snapshots, granularity, filters)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	elapsed := snapshots[len(snapshots)-1].t.Sub(snapshots[0].t)
+	rpt, err := newReport(snapshots[0].p, "inuse_space", goreport.Options{OutputUnit: "minimum"})
+	if err != nil {
+		return []string{err.Error()}
+	}
+	items := []string{
+		fmt.Sprintf("%d heap profiles over %v, captured every %v", len(snapshots), elapsed, growthInterval),
+		fmt.Sprintf("%10s %12s %12s  %-*s  name", "inuse", "growth/min", "alloc/s", len(snapshots), "trend"),
+	}
+	for _, s := range sites {
+		items = append(items, fmt.Sprintf("%10s %12s %12s  %s  %s",
+			rpt.FormatValue(s.inuse[len(s.inuse)-1]),
+			rpt.FormatValue(int64(float64(s.growth)/elapsed.Minutes())),
+			rpt.FormatValue(int64(float64(s.alloc)/elapsed.Seconds())),
+			sparkline(s.inuse),
+			s.name))
+	}
+	return items
+}
+
+// sparkBars are the bars of the sparklines, from the lowest to the
+// highest.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the values as a line of bars scaled between their
+// minimum and their maximum.
+func sparkline(values []int64) string {
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	line := make([]rune, len(values))
+	for i, v := range values {
+		var b int
+		if max > min {
+			b = int((v - min) * int64(len(sparkBars)-1) / (max - min))
+		}
+		line[i] = sparkBars[b]
+	}
+	return string(line)
+}
@@ -0,0 +1,303 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rakyll/gom/internal/commands"
+	"github.com/rakyll/gom/internal/driver"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// maxHistory is the number of commands kept in the history file.
+const maxHistory = 500
+
+// lineEditor edits the input line of the prompt.
+type lineEditor struct {
+	line []rune
+	pos  int // position of the cursor in line
+
+	// history holds the previous commands, the most recent last.
+	// While browsing it, hpos is the index of the command shown, and
+	// saved is the line being edited before.
+	history []string
+	hpos    int
+	saved   string
+}
+
+func (e *lineEditor) String() string { return string(e.line) }
+
+func (e *lineEditor) empty() bool { return len(e.line) == 0 }
+
+func (e *lineEditor) set(s string) {
+	e.line = []rune(s)
+	e.pos = len(e.line)
+}
+
+// reset clears the line and stops browsing the history.
+func (e *lineEditor) reset() {
+	e.set("")
+	e.hpos = len(e.history)
+}
+
+// handleKey edits the line as directed by the key. It reports whether
+// the key is an editing key.
+func (e *lineEditor) handleKey(key string) bool {
+	switch key {
+	case "<left>", "C-b":
+		if e.pos > 0 {
+			e.pos--
+		}
+	case "<right>", "C-f":
+		if e.pos < len(e.line) {
+			e.pos++
+		}
+	case "<home>", "C-a":
+		e.pos = 0
+	case "<end>", "C-e":
+		e.pos = len(e.line)
+	case "C-8", "<backspace>":
+		if e.pos > 0 {
+			e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+			e.pos--
+		}
+	case "<delete>", "C-d":
+		if e.pos < len(e.line) {
+			e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+		}
+	case "C-u":
+		e.line = e.line[e.pos:]
+		e.pos = 0
+	case "C-k":
+		e.line = e.line[:e.pos]
+	case "<up>":
+		e.browse(-1)
+	case "<down>":
+		e.browse(1)
+	case "<space>":
+		e.insert(" ")
+	default:
+		if utf8.RuneCountInString(key) != 1 {
+			return false
+		}
+		e.insert(key)
+	}
+	return true
+}
+
+func (e *lineEditor) insert(s string) {
+	r := []rune(s)
+	line := make([]rune, 0, len(e.line)+len(r))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, r...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(r)
+}
+
+// browse shows the command delta steps away in the history.
+func (e *lineEditor) browse(delta int) {
+	hpos := e.hpos + delta
+	if hpos < 0 || hpos > len(e.history) {
+		return
+	}
+	if e.hpos == len(e.history) {
+		e.saved = e.String()
+	}
+	e.hpos = hpos
+	if hpos == len(e.history) {
+		e.set(e.saved)
+		return
+	}
+	e.set(e.history[hpos])
+}
+
+// complete completes the text before the cursor with c.
+func (e *lineEditor) complete(c commands.Completer) {
+	before := string(e.line[:e.pos])
+	after := string(e.line[e.pos:])
+	completed := c(before)
+	e.set(completed + after)
+	e.pos = utf8.RuneCountInString(completed)
+}
+
+// render renders the line, highlighting the cursor.
+func (e *lineEditor) render() string {
+	if e.pos == len(e.line) {
+		return e.String() + "[ ](bg-white)"
+	}
+	c := string(e.line[e.pos])
+	if c == "[" || c == "]" || c == " " {
+		c = "_"
+	}
+	return string(e.line[:e.pos]) + "[" + c + "](fg-black,bg-white)" + string(e.line[e.pos+1:])
+}
+
+// historyFile is the file the history is persisted to.
+func historyFile() string {
+	return filepath.Join(configDir(), "history")
+}
+
+// loadHistory loads the history persisted to file. Errors are
+// ignored, the history is a convenience.
+func (e *lineEditor) loadHistory(file string) {
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		e.history = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	e.reset()
+}
+
+// addHistory adds cmd to the history and persists it to file, unless
+// cmd repeats the last command.
+func (e *lineEditor) addHistory(cmd, file string) {
+	if cmd == "" || len(e.history) > 0 && e.history[len(e.history)-1] == cmd {
+		return
+	}
+	e.history = append(e.history, cmd)
+	if n := len(e.history); n > maxHistory {
+		e.history = e.history[n-maxHistory:]
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return
+	}
+	ioutil.WriteFile(file, []byte(strings.Join(e.history, "\n")+"\n"), 0644)
+}
+
+// promptCompleter completes the prompt commands and their arguments:
+// function names, sample types, granularities, label keys and session
+// names. Function names are quoted, the commands taking regexps.
+func promptCompleter() commands.Completer {
+	var functions, sampleTypes, labelKeys commands.Completer = noCompletion, noCompletion, noCompletion
+	if p, _ := currentProfile.filtered(nil); p != nil {
+		fc := driver.FunctionCompleter(p)
+		functions = func(s string) string {
+			if c := fc(s); c != s {
+				return regexp.QuoteMeta(c)
+			}
+			return s
+		}
+		sampleTypes = wordCompleter(driver.SampleTypes(p))
+		labelKeys = wordCompleter(goreport.LabelKeys(p))
+	}
+	cmds := commands.Commands{
+		":c":            {},
+		":h":            {},
+		":p":            {Complete: func(s string) string { return wordCompleter(profileNames())(s) }},
+		":r":            {},
+		":s":            {},
+		":rm":           {},
+		":alert":        {},
+		":t":            {},
+		":growth":       {},
+		":leaks":        {},
+		":rate":         {},
+		":target":       {Complete: func(s string) string { return wordCompleter(targetNames())(s) }},
+		":instances":    {},
+		":l":            {Complete: functions, HasParam: true},
+		":peek":         {Complete: functions, HasParam: true},
+		":v":            {Complete: sampleTypes},
+		":g":            {Complete: wordCompleter(driver.Granularities)},
+		":group":        {Complete: labelKeys},
+		":save-session": {Complete: wordCompleter(sessionNames())},
+		":load-session": {Complete: wordCompleter(sessionNames())},
+	}
+	for _, c := range filterCommands {
+		cmds[c.prefix] = &commands.Command{HasParam: true}
+	}
+	complete := commands.NewCompleter(cmds)
+	return func(line string) string {
+		// Filter commands are not separated from their argument.
+		for _, c := range filterCommands {
+			if !strings.HasPrefix(line, c.prefix) || len(line) == len(c.prefix) {
+				continue
+			}
+			arg := line[len(c.prefix):]
+			if c.kind == "tagfocus" || c.kind == "tagignore" {
+				return c.prefix + labelKeys(arg)
+			}
+			return c.prefix + functions(arg)
+		}
+		if strings.HasSuffix(line, " ") {
+			// Nothing to complete.
+			return line
+		}
+		return complete(line)
+	}
+}
+
+func noCompletion(s string) string { return s }
+
+// wordCompleter returns a completer replacing a prefix of one of the
+// words with the word.
+func wordCompleter(words []string) commands.Completer {
+	return func(prefix string) string {
+		found := ""
+		for _, w := range words {
+			if strings.HasPrefix(w, prefix) {
+				if found != "" {
+					return prefix
+				}
+				found = w
+			}
+		}
+		if found != "" {
+			return found
+		}
+		return prefix
+	}
+}
+
+// sessionNames returns the names of the saved sessions.
+func sessionNames() []string {
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(sessionFile("")), "*.json"))
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), ".json"))
+	}
+	return names
+}
+
+// profileNames returns the names of the profiles of the target.
+func profileNames() []string {
+	if benchProfiles != nil {
+		return benchProfileNames()
+	}
+	l, _ := fetchProfileList(*target)
+	var names []string
+	for _, p := range l {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// targetNames returns the names of the targets of the config file and
+// of the instances pushing to the collector.
+func targetNames() []string {
+	var names []string
+	for name := range conf.Targets {
+		names = append(names, name)
+	}
+	if conf.Collector != "" {
+		instances, _ := fetchInstances(conf.Collector)
+		names = append(names, instances...)
+	}
+	return names
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui"
+	"github.com/rakyll/gom/internal/goroutine"
+)
+
+// maxGoroutineSnapshots is the number of goroutine dumps kept to find
+// the stacks whose goroutines keep growing.
+const maxGoroutineSnapshots = 10
+
+var (
+	// leakView is set while the goroutine leak view is shown.
+	leakView bool
+
+	// leakInterval is the interval between the goroutine dumps, or
+	// zero if the goroutines are not dumped.
+	leakInterval time.Duration
+
+	// goroutineSnapshots are the goroutine dumps captured, oldest
+	// first.
+	goroutineSnapshots []goroutineSnapshot
+
+	// goroutinesCapturing is set while the goroutines are dumped.
+	goroutinesCapturing bool
+)
+
+// goroutinesDone receives the goroutine dumps captured, off the UI
+// goroutine, as goroutinesResult events.
+var goroutinesDone = make(chan ui.Event)
+
+// A goroutinesResult is the outcome of the dump of the goroutines of
+// target.
+type goroutinesResult struct {
+	target string
+	snap   goroutineSnapshot
+	err    error
+}
+
+// A goroutineSnapshot is a goroutine dump captured at a given time.
+type goroutineSnapshot struct {
+	t time.Time
+	s goroutine.Snapshot
+}
+
+// captureGoroutines dumps the goroutines of the target in the
+// background if the leak interval has elapsed since the last dump, and
+// sends the dump to goroutinesDone.
+func captureGoroutines(now time.Time) {
+	if leakInterval == 0 || goroutinesCapturing {
+		return
+	}
+	if n := len(goroutineSnapshots); n > 0 && now.Sub(goroutineSnapshots[n-1].t) < leakInterval {
+		return
+	}
+	goroutinesCapturing = true
+	target := *target
+	go func() {
+		s, err := fetchGoroutines(target)
+		goroutinesDone <- ui.Event{Path: "/gom/goroutines", Data: goroutinesResult{target, goroutineSnapshot{t: now, s: s}, err}}
+	}()
+}
+
+// addGoroutineSnapshot keeps the goroutine dump captured by
+// captureGoroutines, if still captured for the current target.
+func addGoroutineSnapshot(r goroutinesResult) {
+	goroutinesCapturing = false
+	if r.target != *target || leakInterval == 0 {
+		return
+	}
+	if r.err != nil {
+		displayMsg(fmt.Sprintf("error dumping the goroutines: %v", r.err))
+		return
+	}
+	goroutineSnapshots = append(goroutineSnapshots, r.snap)
+	if n := len(goroutineSnapshots); n > maxGoroutineSnapshots {
+		goroutineSnapshots = goroutineSnapshots[n-maxGoroutineSnapshots:]
+	}
+	if leakView {
+		loadProfile(false)
+	}
+}
+
+// fetchGoroutines fetches the goroutine dump of the target.
+func fetchGoroutines(target string) (goroutine.Snapshot, error) {
+	c := &http.Client{Timeout: 60 * time.Second}
+	resp, err := c.Get(fmt.Sprintf("%s/debug/_gom?view=profile&name=goroutine&debug=2", target))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server response: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return goroutine.Parse(b)
+}
+
+// leakReport lists the stacks whose goroutines grew monotonically over
+// the dumps, with the trend of their number and the function that
+// created them.
+func leakReport(snapshots []goroutineSnapshot) []string {
+	if len(snapshots) < 2 {
+		return []string{fmt.Sprintf("dumping the goroutines every %v, waiting for a second dump...", leakInterval)}
+	}
+	var ss []goroutine.Snapshot
+	for _, s := range snapshots {
+		ss = append(ss, s.s)
+	}
+	elapsed := snapshots[len(snapshots)-1].t.Sub(snapshots[0].t)
+	growing := goroutine.Growing(ss...)
+	items := []string{
+		fmt.Sprintf("%d goroutine dumps over %v, captured every %v: %d stacks kept growing", len(snapshots), elapsed, leakInterval, len(growing)),
+		fmt.Sprintf("%8s %8s  %-*s  stack", "count", "growth", len(snapshots), "trend"),
+	}
+	for _, g := range growing {
+		counts := make([]int64, len(g.Counts))
+		for i, c := range g.Counts {
+			counts[i] = int64(c)
+		}
+		createdBy := g.CreatedBy
+		if createdBy == "" {
+			createdBy = "the runtime"
+		}
+		items = append(items,
+			fmt.Sprintf("%8d %+8d  %s  [created by %s](fg-bold)", g.Counts[len(g.Counts)-1], g.Delta(), sparkline(counts), createdBy),
+			fmt.Sprintf("%*s  %s", 19+len(snapshots), "", strings.Join(g.Stack, " < ")))
+	}
+	return items
+}
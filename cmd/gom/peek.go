@@ -0,0 +1,166 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// The peek view shows the callers and the callees of a node of the
+// call graph. The user can move the cursor over them and re-center the
+// view on the selected one.
+var (
+	// peekHistory holds the names of the nodes the peek view has been
+	// centered on. The view is centered on the last one. If empty, the
+	// peek view is not shown.
+	peekHistory []string
+
+	// peekCursor is the index of the selected caller or callee in
+	// peekNeighbors.
+	peekCursor    int
+	peekNeighbors []*goreport.Node
+)
+
+// startPeek centers the peek view on the heaviest node matching rx.
+func startPeek(p *profile.Profile, stype, granularity string, rx *regexp.Regexp) error {
+	g, _, err := peekGraph(p, stype, granularity)
+	if err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		if rx.MatchString(n.Name) {
+			peekHistory = []string{n.Name}
+			peekCursor = 0
+			return nil
+		}
+	}
+	return fmt.Errorf("no samples found on functions matching %v", rx)
+}
+
+// recenterPeek centers the peek view on the selected caller or callee.
+func recenterPeek() {
+	if peekCursor < len(peekNeighbors) {
+		peekHistory = append(peekHistory, peekNeighbors[peekCursor].Name)
+		peekCursor = 0
+	}
+}
+
+// backPeek centers the peek view on the previous node of the history.
+// It reports whether there was one.
+func backPeek() bool {
+	if len(peekHistory) < 2 {
+		return false
+	}
+	peekHistory = peekHistory[:len(peekHistory)-1]
+	peekCursor = 0
+	return true
+}
+
+// movePeekCursor moves the cursor by delta, within the neighbors.
+func movePeekCursor(delta int) {
+	peekCursor += delta
+	if peekCursor >= len(peekNeighbors) {
+		peekCursor = len(peekNeighbors) - 1
+	}
+	if peekCursor < 0 {
+		peekCursor = 0
+	}
+}
+
+func peekGraph(p *profile.Profile, stype, granularity string) (*goreport.Graph, *goreport.Report, error) {
+	if err := driver.Aggregate(p, granularity); err != nil {
+		return nil, nil, err
+	}
+	rpt, err := newReport(p, stype, goreport.Options{CumSort: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	g, err := goreport.NewGraph(rpt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, rpt, nil
+}
+
+// peek lists the callers and the callees of the node the peek view is
+// centered on, updates the neighbors the cursor moves over and selects
+// the one under the cursor. It also returns the index of the item
+// under the cursor.
+func peek(p *profile.Profile, stype, granularity string) ([]string, int) {
+	files := functionFiles(p)
+	g, rpt, err := peekGraph(p, stype, granularity)
+	if err != nil {
+		return []string{err.Error()}, 0
+	}
+	name := peekHistory[len(peekHistory)-1]
+	var center *goreport.Node
+	for _, n := range g.Nodes {
+		if n.Name == name {
+			center = n
+			break
+		}
+	}
+	peekNeighbors = nil
+	if center == nil {
+		return []string{fmt.Sprintf("%s has no samples", name)}, 0
+	}
+
+	total := rpt.Total()
+	var items []string
+	cursorItem := 0
+	edge := func(e *goreport.Edge, n *goreport.Node, sum int64) {
+		item := fmt.Sprintf("%10s %s    %s", rpt.FormatValue(e.Weight), percentage(e.Weight, sum), n.Name)
+		if len(peekNeighbors) == peekCursor {
+			item = fmt.Sprintf("[%s](%s)", item, conf.Colors.Cursor)
+			cursorItem = len(items)
+			selectNode(rpt, n, files)
+		}
+		peekNeighbors = append(peekNeighbors, n)
+		items = append(items, item)
+	}
+
+	items = append(items, fmt.Sprintf("%10s %7s    callers", "calls", "calls%"))
+	var sum int64
+	for _, e := range center.In {
+		sum += e.Weight
+	}
+	for _, e := range center.In {
+		edge(e, e.From, sum)
+	}
+	items = append(items, "", fmt.Sprintf("[%10s %s %10s %s  %s](fg-bold)",
+		rpt.FormatValue(center.Flat), percentage(center.Flat, total),
+		rpt.FormatValue(center.Cum), percentage(center.Cum, total), center.Name), "")
+	items = append(items, fmt.Sprintf("%10s %7s    callees", "calls", "calls%"))
+	sum = 0
+	for _, e := range center.Out {
+		sum += e.Weight
+	}
+	for _, e := range center.Out {
+		edge(e, e.To, sum)
+	}
+	return items, cursorItem
+}
+
+func percentage(v, total int64) string {
+	if total == 0 {
+		return "      -"
+	}
+	return fmt.Sprintf("%6.2f%%", float64(v)*100/float64(total))
+}
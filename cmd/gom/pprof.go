@@ -0,0 +1,112 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/fetch"
+	"github.com/rakyll/gom/internal/plugin"
+	"github.com/rakyll/gom/internal/profile"
+	"github.com/rakyll/gom/internal/symbolz"
+)
+
+// pprof runs the pprof driver with the given command line arguments.
+// Profiles are fetched from gom targets, e.g. localhost:6060/heap,
+// and symbolized by the target's symbol handler.
+func pprof(args []string) error {
+	return driver.PProf(&flagSet{flag.NewFlagSet("pprof", flag.ExitOnError), args}, fetchPProf, symbolizePProf, plugin.NoObjTool(), plugin.StandardUI(), nil)
+}
+
+// flagSet implements plugin.FlagSet over the standard flag package.
+type flagSet struct {
+	*flag.FlagSet
+	args []string
+}
+
+func (f *flagSet) ExtraUsage() string {
+	return "Profile sources can be gom targets with a profile name,\n" +
+		"e.g. localhost:6060/heap or localhost:6060/profile.\n"
+}
+
+func (f *flagSet) Parse(usage func()) []string {
+	f.Usage = usage
+	f.FlagSet.Parse(f.args)
+	args := f.Args()
+	if len(args) == 0 {
+		usage()
+	}
+	return args
+}
+
+// fetchPProf implements plugin.Fetcher for gom targets.
+func fetchPProf(src string, timeout time.Duration, ui plugin.UI) (*profile.Profile, error) {
+	return fetch.Fetcher(gomURL(src, "profile"), timeout, ui)
+}
+
+// symbolizePProf implements plugin.Symbolizer for remote profiles by
+// querying the symbol handler of the target they were fetched from.
+func symbolizePProf(mode, src string, p *profile.Profile, obj plugin.ObjTool, ui plugin.UI) error {
+	if mode == "none" {
+		return nil
+	}
+	u, err := url.Parse(gomURL(src, "symbol"))
+	if err != nil || u.Host == "" {
+		// Local profiles are expected to be symbolized.
+		return nil
+	}
+	if strings.HasPrefix(u.Path, "/debug/pprof/") {
+		u.Path, u.RawQuery = "/debug/pprof/symbol", ""
+	}
+	return symbolz.Symbolize(u.String(), fetch.PostURL, p)
+}
+
+// gomURL rewrites URLs of the form host:port/name to the given view
+// of the gom handler for the named profile. The driver defaults
+// host:port to the CPU profile at host:port/profilez. Files and
+// other URLs are returned unchanged.
+func gomURL(src, view string) string {
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" {
+		return src
+	}
+	q := u.Query()
+	switch {
+	case strings.HasSuffix(u.Path, "/debug/_gom"):
+	case strings.HasPrefix(u.Path, "/debug/"):
+		return src
+	default:
+		// Targets served by a collector are prefixed with
+		// /<service>/<instance>.
+		prefix, name := path.Split(strings.Trim(u.Path, "/"))
+		if name == "" || name == "profilez" {
+			name = "profile"
+		}
+		q.Set("name", name)
+		u.Path = "/" + prefix + "debug/_gom"
+	}
+	q.Set("view", view)
+	if view == "symbol" {
+		q.Del("name")
+		q.Del("seconds")
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
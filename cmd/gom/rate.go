@@ -0,0 +1,124 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rates are the profiling rates of a target.
+type rates struct {
+	MemProfileRate   int   `json:"mem_profile_rate"`
+	BlockProfileRate int   `json:"block_profile_rate"`
+	MutexFraction    int   `json:"mutex_fraction"`
+	RevertAt         int64 `json:"revert_at"`
+}
+
+func (r *rates) String() string {
+	s := fmt.Sprintf("mem %d, block %d, mutex %d", r.MemProfileRate, r.BlockProfileRate, r.MutexFraction)
+	if r.RevertAt != 0 {
+		s += ", reverting at " + time.Unix(r.RevertAt, 0).Format("15:04:05")
+	}
+	return s
+}
+
+// rateParams are the names of the rates in :rate, and of their
+// parameters in the config view of the target.
+var rateParams = map[string]string{
+	"mem":   "mem_profile_rate",
+	"block": "block_profile_rate",
+	"mutex": "mutex_fraction",
+}
+
+// handleRate shows the profiling rates of the target, or changes them
+// as in :rate mem=4096 block=1 for=10m; :rate reset restores them.
+func handleRate(arg string) {
+	params := url.Values{}
+	for _, f := range strings.Fields(arg) {
+		if f == "reset" {
+			params.Set("reset", "1")
+			continue
+		}
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			displayMsg(fmt.Sprintf("invalid rate %s, want name=value", f))
+			return
+		}
+		if kv[0] == "for" {
+			d, err := time.ParseDuration(kv[1])
+			if err != nil || d < time.Second {
+				displayMsg(fmt.Sprintf("invalid duration %s", kv[1]))
+				return
+			}
+			params.Set("revert", strconv.Itoa(int(d.Seconds())))
+			continue
+		}
+		name, ok := rateParams[kv[0]]
+		if !ok {
+			displayMsg(fmt.Sprintf("unknown rate %s, want mem, block or mutex", kv[0]))
+			return
+		}
+		params.Set(name, kv[1])
+	}
+	r, err := fetchRates(*target, params)
+	if err != nil {
+		displayMsg(fmt.Sprintf("error with the rates: %v", err))
+		return
+	}
+	displayMsg("rates: " + r.String())
+}
+
+// fetchRates gets the profiling rates of target, after setting them
+// to params if not empty.
+func fetchRates(target string, params url.Values) (*rates, error) {
+	u := fmt.Sprintf("%s/debug/_gom?view=config", target)
+	method := "GET"
+	var body string
+	if len(params) > 0 {
+		method = "POST"
+		body = params.Encode()
+	}
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Authorization", "Bearer "+conf.ConfigToken)
+	c := &http.Client{Timeout: 10 * time.Second}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server response: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var r rates
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -15,13 +15,16 @@
 package main
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/rakyll/gom/internal/driver"
 	"github.com/rakyll/gom/internal/fetch"
 	"github.com/rakyll/gom/internal/profile"
 	goreport "github.com/rakyll/gom/internal/report"
@@ -33,48 +36,303 @@ type report struct {
 	p  *profile.Profile
 
 	name string
+
+	// sampleType is the sample type reported, or empty for the default
+	// sample type of the profile.
+	sampleType string
 }
 
-// fetch fetches the current profile and the symbols from the target program.
-func (r *report) fetch(force bool, secs time.Duration) error {
+var (
+	// profiles are the profiles opened, by name.
+	profiles = map[string]*report{
+		cpuProfile.name:  cpuProfile,
+		heapProfile.name: heapProfile,
+	}
+	profilesMu sync.Mutex
+)
+
+// profileReport returns the report of the named profile, creating it
+// if it was not opened yet and the target has such a profile.
+func profileReport(name string) (*report, error) {
+	profilesMu.Lock()
+	r, ok := profiles[name]
+	profilesMu.Unlock()
+	if ok {
+		return r, nil
+	}
+
+	var names []string
+	if benchProfiles != nil {
+		names = benchProfileNames()
+	} else {
+		l, err := fetchProfileList(*target)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range l {
+			names = append(names, p.Name)
+		}
+	}
+	found := false
+	for _, n := range names {
+		found = found || n == name
+	}
+	if !found {
+		return nil, fmt.Errorf("no %s profile; profiles are: %s", name, strings.Join(names, ", "))
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	if r, ok = profiles[name]; !ok {
+		r = &report{name: name}
+		profiles[name] = r
+	}
+	return r, nil
+}
+
+// A profileInfo describes a profile of the target.
+type profileInfo struct {
+	Name string `json:"name"`
+	// Count is the number of entries of the profile, nil if unknown,
+	// e.g. for the profiles served by a collector.
+	Count *int `json:"count"`
+}
+
+type profileInfos []profileInfo
+
+func (s profileInfos) Len() int           { return len(s) }
+func (s profileInfos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s profileInfos) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// fetchProfileList lists the profiles of the target, including its
+// custom profiles.
+func fetchProfileList(target string) ([]profileInfo, error) {
+	c := &http.Client{Timeout: 10 * time.Second}
+	resp, err := c.Get(fmt.Sprintf("%s/debug/_gom?view=list", target))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server response: %s", resp.Status)
+	}
+	var l []profileInfo
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, err
+	}
+	sort.Sort(profileInfos(l))
+	return l, nil
+}
+
+// fetch fetches the current profile and the symbols from the target
+// program, or reads it for benchmarks. CPU profiles are collected for
+// the given number of seconds, or for the default duration of the
+// target if zero.
+func (r *report) fetch(force bool, seconds int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.p != nil && !force {
 		return nil
 	}
-	if secs == 0 {
-		secs = 60 * time.Second
+	var p *profile.Profile
+	var err error
+	if benchProfiles != nil {
+		p, err = benchProfile(r.name)
+	} else {
+		p, err = fetchProfile(*target, r.name, seconds)
 	}
-	url := fmt.Sprintf("%s/debug/_gom?view=profile&name=%s", *target, r.name)
-	p, err := fetch.FetchProfile(url, secs)
 	if err != nil {
 		return err
 	}
-	if err := symbolz.Symbolize(fmt.Sprintf("%s/debug/_gom?view=symbol", *target), fetch.PostURL, p); err != nil {
-		return err
-	}
 	r.p = p
 	return nil
 }
 
-// filter filters the report with a focus regex. If no focus is provided,
-// it reports back with the entire set of calls.
-// Focus regex works on the package, type and function names. Filtered
-// results will include parent samples from the call graph.
-func (r *report) filter(cum bool, focus *regexp.Regexp) []string {
+// fetchProfile fetches the named profile and its symbols from target.
+func fetchProfile(target, name string, seconds int) (*profile.Profile, error) {
+	url := fmt.Sprintf("%s/debug/_gom?view=profile&name=%s", target, name)
+	timeout := 60 * time.Second
+	if seconds > 0 {
+		url += fmt.Sprintf("&seconds=%d", seconds)
+		timeout = time.Duration(seconds)*time.Second + 30*time.Second
+	}
+	p, err := fetch.FetchProfile(url, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := symbolz.Symbolize(fmt.Sprintf("%s/debug/_gom?view=symbol", target), fetch.PostURL, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// filtered returns a copy of the profile with the filters applied, and
+// the filters that matched no samples. The profile is nil if it has
+// not been fetched yet.
+func (r *report) filtered(filters []sampleFilter) (*profile.Profile, map[int]bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.p == nil {
-		return nil
+		return nil, nil
 	}
 	c := r.p.Copy()
-	c.FilterSamplesByName(focus, nil, nil)
-	rpt := goreport.NewDefault(c, goreport.Options{
-		OutputFormat:   goreport.Text,
+	return c, applyFilters(c, filters)
+}
+
+// sampleTypes returns the sample types that can be reported, or nil
+// if the profile has not been fetched yet.
+func (r *report) sampleTypes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.p == nil {
+		return nil
+	}
+	return driver.SampleTypes(r.p)
+}
+
+// newReport creates a report of the values of the sample type stype of
+// p, or of its default sample type if stype is empty.
+func newReport(p *profile.Profile, stype string, o goreport.Options) (*goreport.Report, error) {
+	value, t, unit, err := driver.SampleValue(p, stype)
+	if err != nil {
+		return nil, err
+	}
+	o.SampleType = t
+	return goreport.New(p, o, value, strings.ToLower(unit)), nil
+}
+
+// top lists the top entries of the profile at the given granularity,
+// and selects the one under the cursor. It also returns the index of
+// the item under the cursor. The profile is filtered already, by
+// report.filtered: focus and ignore keep or drop whole samples, so the
+// callers of the matching functions remain listed, hide drops their
+// frames, and the label filters match the labels of the samples.
+func top(p *profile.Profile, stype, granularity string, cum bool) ([]string, int) {
+	files := functionFiles(p)
+	if err := driver.Aggregate(p, granularity); err != nil {
+		return []string{err.Error()}, 0
+	}
+	rpt, err := newReport(p, stype, goreport.Options{
 		CumSort:        cum,
-		PrintAddresses: true,
+		PrintAddresses: granularity == "addresses",
 	})
-	buf := bytes.NewBuffer(nil)
-	goreport.Generate(buf, rpt, nil)
-	return strings.Split(buf.String(), "\n")
+	if err != nil {
+		return []string{err.Error()}, 0
+	}
+	t, err := goreport.NewTable(rpt)
+	if err != nil {
+		return []string{err.Error()}, 0
+	}
+	topNodes = topNodes[:0]
+	for _, r := range t.Rows {
+		topNodes = append(topNodes, r.Node)
+	}
+	moveTopCursor(0)
+
+	items := []string{
+		fmt.Sprintf("%s total", rpt.FormatValue(t.Total)),
+		fmt.Sprintf("%10s %7s %7s %10s %7s  %s", "flat", "flat%", "sum%", "cum", "cum%", "name"),
+	}
+	cursorItem := 0
+	for i, r := range t.Rows {
+		item := fmt.Sprintf("%10s %6.2f%% %6.2f%% %10s %6.2f%%  %s",
+			rpt.FormatValue(r.Flat), r.FlatPercent, r.FlatSumPercent,
+			rpt.FormatValue(r.Cum), r.CumPercent, r.Name)
+		if i == topCursor {
+			item = fmt.Sprintf("[%s](%s)", item, conf.Colors.Cursor)
+			cursorItem = len(items)
+			selectNode(rpt, r.Node, files)
+		}
+		items = append(items, item)
+	}
+	return items, cursorItem
+}
+
+// source lists the annotated source of the functions matching symbol,
+// highlighting the hottest lines. Source files are located with rules.
+// The locations of p are aggregated by line.
+func source(p *profile.Profile, stype string, symbol *regexp.Regexp, rules []goreport.PathRule) []string {
+	if err := p.Aggregate(true, true, true, true, false); err != nil {
+		return []string{err.Error()}
+	}
+	rpt, err := newReport(p, stype, goreport.Options{
+		OutputFormat: goreport.List,
+		Symbol:       symbol,
+		SourcePath:   rules,
+	})
+	if err != nil {
+		return []string{err.Error()}
+	}
+	srcs, err := goreport.Source(rpt)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if len(srcs) == 0 {
+		return []string{fmt.Sprintf("no samples found on functions matching %v", symbol)}
+	}
+	var items []string
+	for _, src := range srcs {
+		items = append(items, fmt.Sprintf("[%s](fg-bold) %s", src.Name, src.File))
+		if src.Err != nil {
+			items = append(items, fmt.Sprintf("  %v", src.Err), "")
+			continue
+		}
+		items = append(items, fmt.Sprintf("%10s %10s (flat, cum) of %s",
+			rpt.FormatValue(src.Flat), rpt.FormatValue(src.Cum), rpt.FormatValue(rpt.Total())))
+		var max int64
+		for _, l := range src.Lines {
+			if l.Cum > max {
+				max = l.Cum
+			}
+		}
+		for _, l := range src.Lines {
+			item := fmt.Sprintf("%10s %10s %6d: %s", valueOrDot(rpt, l.Flat), valueOrDot(rpt, l.Cum), l.Line, l.Text)
+			switch {
+			case l.Cum == 0:
+			case l.Cum*2 >= max:
+				item = fmt.Sprintf("[%s](%s)", item, conf.Colors.Hot)
+			default:
+				item = fmt.Sprintf("[%s](%s)", item, conf.Colors.Warm)
+			}
+			items = append(items, item)
+		}
+		items = append(items, "")
+	}
+	return items
+}
+
+// labels breaks down the profile by the values of the label key.
+func labels(p *profile.Profile, stype, key string) []string {
+	keys := goreport.LabelKeys(p)
+	found := false
+	for _, k := range keys {
+		found = found || k == key
+	}
+	if !found {
+		if len(keys) == 0 {
+			return []string{"the profile has no labels"}
+		}
+		return []string{fmt.Sprintf("no samples labeled with %s; labels are: %s", key, strings.Join(keys, ", "))}
+	}
+	rpt, err := newReport(p, stype, goreport.Options{})
+	if err != nil {
+		return []string{err.Error()}
+	}
+	total := rpt.Total()
+	items := []string{fmt.Sprintf("%10s %7s  %s", "value", "", key)}
+	for _, lv := range goreport.LabelBreakdown(rpt, key) {
+		name := lv.Value
+		if name == "" {
+			name = "(unlabeled)"
+		}
+		items = append(items, fmt.Sprintf("%10s %s  %s", rpt.FormatValue(lv.Weight), percentage(lv.Weight, total), name))
+	}
+	return items
+}
+
+func valueOrDot(rpt *goreport.Report, v int64) string {
+	if v == 0 {
+		return "."
+	}
+	return rpt.FormatValue(v)
 }
@@ -0,0 +1,178 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// The top view lists the nodes of the call graph. The user can move
+// the cursor over them; the detail pane describes the selected node
+// and single-key shortcuts act on it.
+var (
+	// topCursor is the index of the selected node in topNodes.
+	topCursor int
+	topNodes  []*goreport.Node
+
+	// selected is the node under the cursor of the top or the peek
+	// view, or nil if the current view has no cursor. selectedDetail
+	// describes it.
+	selected       *goreport.Node
+	selectedDetail string
+)
+
+// moveTopCursor moves the cursor of the top view by delta, within the
+// nodes.
+func moveTopCursor(delta int) {
+	topCursor += delta
+	if topCursor >= len(topNodes) {
+		topCursor = len(topNodes) - 1
+	}
+	if topCursor < 0 {
+		topCursor = 0
+	}
+}
+
+// functionFiles maps the function names of p to their source files.
+// It has to be called before p is aggregated, which may drop the
+// file names.
+func functionFiles(p *profile.Profile) map[string]string {
+	files := make(map[string]string)
+	for _, f := range p.Function {
+		if f.Filename != "" {
+			files[f.Name] = f.Filename
+		}
+	}
+	return files
+}
+
+// selectNode selects n, and describes it with its file, its values and
+// its heaviest callers and callees.
+func selectNode(rpt *goreport.Report, n *goreport.Node, files map[string]string) {
+	selected = n
+	total := rpt.Total()
+	lines := []string{fmt.Sprintf("[%s](fg-bold)", n.Name)}
+	file := n.File
+	if file == "" {
+		file = files[n.Function]
+	}
+	switch {
+	case file == "":
+		lines = append(lines, "(unknown file)")
+	case n.Line > 0:
+		lines = append(lines, fmt.Sprintf("%s:%d", file, n.Line))
+	default:
+		lines = append(lines, file)
+	}
+	lines = append(lines, fmt.Sprintf("flat %s (%s)  cum %s (%s)",
+		rpt.FormatValue(n.Flat), strings.TrimSpace(percentage(n.Flat, total)),
+		rpt.FormatValue(n.Cum), strings.TrimSpace(percentage(n.Cum, total))))
+	var callers, callees []string
+	for i, e := range n.In {
+		if i == 3 {
+			break
+		}
+		callers = append(callers, fmt.Sprintf("%s (%s)", e.From.Name, rpt.FormatValue(e.Weight)))
+	}
+	for i, e := range n.Out {
+		if i == 3 {
+			break
+		}
+		callees = append(callees, fmt.Sprintf("%s (%s)", e.To.Name, rpt.FormatValue(e.Weight)))
+	}
+	lines = append(lines, "callers: "+orNone(callers), "callees: "+orNone(callees))
+	selectedDetail = strings.Join(lines, "\n")
+}
+
+func orNone(s []string) string {
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
+
+// selectionExpr returns a regexp matching the samples of the selected
+// node at the given granularity, for filters and source listings.
+func selectionExpr(n *goreport.Node, granularity string) (string, error) {
+	switch {
+	case granularity == "packages":
+		return "^" + regexp.QuoteMeta(n.Function) + `\.`, nil
+	case n.Function != "":
+		return "^" + regexp.QuoteMeta(n.Function) + "$", nil
+	case n.File != "":
+		return "^" + regexp.QuoteMeta(n.File) + "$", nil
+	}
+	return "", fmt.Errorf("%s has no symbol to match", n.Name)
+}
+
+// handleSelection runs the single-key shortcut key on the selected
+// node. It reports whether key is a shortcut.
+func handleSelection(key string) bool {
+	if selected == nil {
+		return false
+	}
+	switch key {
+	case "f", "i":
+		displayMsg("")
+		expr, err := selectionExpr(selected, granularity)
+		if err != nil {
+			displayMsg(err.Error())
+			return true
+		}
+		kind := "focus"
+		if key == "i" {
+			kind = "ignore"
+		}
+		f, err := newFilter(kind, expr)
+		if err != nil {
+			displayMsg(err.Error())
+			return true
+		}
+		filters = append(filters, f)
+		topCursor = 0
+	case "p":
+		displayMsg("")
+		peekHistory = append(peekHistory, selected.Name)
+		peekCursor = 0
+		if len(peekHistory) == 1 {
+			list = ""
+			group = ""
+		}
+	case "l":
+		displayMsg("")
+		if selected.Function == "" || granularity == "files" {
+			displayMsg(fmt.Sprintf("%s is not a function", selected.Name))
+			return true
+		}
+		expr, err := selectionExpr(selected, granularity)
+		if err != nil {
+			displayMsg(err.Error())
+			return true
+		}
+		list = expr
+		group = ""
+		peekHistory = nil
+	default:
+		return false
+	}
+	reportPage = 0
+	loadProfile(false)
+	return true
+}
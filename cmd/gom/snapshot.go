@@ -0,0 +1,267 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+)
+
+// snapshotProfiles are the profiles captured by a snapshot, by file
+// name prefix.
+var snapshotProfiles = []struct {
+	file, name string
+}{
+	{"cpu", "profile"},
+	{"heap", "heap"},
+	{"goroutine", "goroutine"},
+	{"block", "block"},
+	{"mutex", "mutex"},
+	{"threadcreate", "threadcreate"},
+}
+
+// manifest is the index of a snapshot bundle.
+type manifest struct {
+	Target   string          `json:"target"`
+	Time     time.Time       `json:"time"`
+	Stats    string          `json:"stats,omitempty"`
+	Profiles []*manifestFile `json:"profiles"`
+	Errors   []string        `json:"errors,omitempty"`
+}
+
+type manifestFile struct {
+	Name        string   `json:"name"`
+	Proto       string   `json:"proto"`
+	Top         string   `json:"top"`
+	SampleTypes []string `json:"sample_types"`
+	Samples     int      `json:"samples"`
+}
+
+// snapshot captures the profiles and the stats of a target and writes
+// them with their top reports and a manifest into a directory, or
+// into a tarball if the output name ends in .tar.gz or .tgz. It fails
+// without writing anything if no profile could be captured.
+func snapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	target := fs.String("target", "http://localhost:6060", "the target process to snapshot")
+	out := fs.String("out", "", "output directory, or tarball if it ends in .tar.gz or .tgz")
+	seconds := fs.Int("seconds", 30, "duration of the CPU profile in seconds")
+	fs.Parse(args)
+	if !isFlagSet(fs, "target") && conf.Target != "" {
+		*target = conf.Target
+	}
+	*target = resolveTarget(*target)
+	if *out == "" {
+		fs.Usage()
+		return fmt.Errorf("no output specified")
+	}
+
+	files, m := captureSnapshot(*target, *seconds)
+	if len(m.Profiles) == 0 {
+		return fmt.Errorf("no profile captured from %s:\n%s", *target, strings.Join(m.Errors, "\n"))
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	files["manifest.json"] = b
+
+	if strings.HasSuffix(*out, ".tar.gz") || strings.HasSuffix(*out, ".tgz") {
+		err = writeTarball(*out, files)
+	} else {
+		err = writeDir(*out, files)
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range m.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	fmt.Fprintf(os.Stderr, "Saved snapshot of %s in %s\n", *target, *out)
+	return nil
+}
+
+// captureSnapshot concurrently fetches the snapshot profiles and the
+// stats of target. It returns the contents of the bundle by file name
+// and its manifest. Failures are recorded in the manifest.
+func captureSnapshot(target string, seconds int) (map[string][]byte, *manifest) {
+	files := make(map[string][]byte)
+	m := &manifest{
+		Target: target,
+		Time:   time.Now(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	add := func(name string, b []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		files[name] = b
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		m.Errors = append(m.Errors, err.Error())
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s, err := fetchStats(target)
+		if err != nil {
+			fail(fmt.Errorf("fetching stats: %v", err))
+			return
+		}
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			fail(err)
+			return
+		}
+		add("stats.json", b)
+	}()
+
+	mfs := make([]*manifestFile, len(snapshotProfiles))
+	for i, sp := range snapshotProfiles {
+		wg.Add(1)
+		go func(i int, file, name string) {
+			defer wg.Done()
+			secs := 0
+			if name == "profile" {
+				secs = seconds
+			}
+			p, err := fetchProfile(target, name, secs)
+			if err != nil {
+				fail(fmt.Errorf("fetching %s profile: %v", name, err))
+				return
+			}
+			var proto bytes.Buffer
+			if err := p.Write(&proto); err != nil {
+				fail(fmt.Errorf("writing %s profile: %v", name, err))
+				return
+			}
+			mf := &manifestFile{
+				Name:    name,
+				Proto:   file + ".pb.gz",
+				Top:     file + ".txt",
+				Samples: len(p.Sample),
+			}
+			for _, st := range p.SampleType {
+				mf.SampleTypes = append(mf.SampleTypes, st.Type+"/"+st.Unit)
+			}
+			add(mf.Proto, proto.Bytes())
+			add(mf.Top, topReport(p))
+			mfs[i] = mf
+		}(i, sp.file, sp.name)
+	}
+	wg.Wait()
+
+	if _, ok := files["stats.json"]; ok {
+		m.Stats = "stats.json"
+	}
+	for _, mf := range mfs {
+		if mf != nil {
+			m.Profiles = append(m.Profiles, mf)
+		}
+	}
+	return files, m
+}
+
+// topReport generates a text report of the top functions of p.
+func topReport(p *profile.Profile) []byte {
+	if p.Empty() {
+		return []byte("profile is empty\n")
+	}
+	c := p.Copy()
+	if err := c.Aggregate(true, true, false, false, false); err != nil {
+		return []byte(err.Error() + "\n")
+	}
+	rpt := goreport.NewDefault(c, goreport.Options{
+		OutputFormat: goreport.Text,
+		OutputUnit:   "minimum",
+		SampleType:   c.SampleType[len(c.SampleType)-1].Type,
+	})
+	var buf bytes.Buffer
+	if err := goreport.Generate(&buf, rpt, nil); err != nil {
+		return []byte(err.Error() + "\n")
+	}
+	return buf.Bytes()
+}
+
+func writeDir(dir string, files map[string][]byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTarball(name string, files map[string][]byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Put the bundle files under a directory named after the tarball.
+	dir := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(name), ".tgz"), ".tar.gz")
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b := files[name]
+		hdr := &tar.Header{
+			Name:    dir + "/" + name,
+			Mode:    0644,
+			Size:    int64(len(b)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
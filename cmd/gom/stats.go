@@ -21,14 +21,17 @@ import (
 )
 
 type stats struct {
-	Goroutine int   `json:"goroutine"`
-	Thread    int   `json:"thread"`
-	Block     int   `json:"block"`
-	Timestamp int64 `json:"timestamp"`
+	Goroutine int    `json:"goroutine"`
+	Thread    int    `json:"thread"`
+	Block     int    `json:"block"`
+	HeapAlloc uint64 `json:"heap_alloc"`
+	NumGC     uint32 `json:"num_gc"`
+	PauseNs   uint64 `json:"pause_ns"`
+	Timestamp int64  `json:"timestamp"`
 }
 
-func fetchStats() (s stats, err error) {
-	url := fmt.Sprintf("%s/debug/_gom", *target)
+func fetchStats(target string) (s stats, err error) {
+	url := fmt.Sprintf("%s/debug/_gom", target)
 	resp, err := http.Get(url)
 	if err != nil {
 		return s, err
@@ -0,0 +1,175 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	ui "github.com/gizak/termui"
+	goreport "github.com/rakyll/gom/internal/report"
+	"github.com/rakyll/gom/internal/tracestats"
+)
+
+// traceSummary is the summary of the last execution trace captured.
+// If nil, the trace view is not shown.
+var traceSummary []string
+
+// traceCapturing is set while an execution trace is captured.
+var traceCapturing bool
+
+// traceDone receives the traces captured, off the UI goroutine, as
+// traceResult events.
+var traceDone = make(chan ui.Event)
+
+// A traceResult is the outcome of the capture of a trace of target.
+type traceResult struct {
+	target  string
+	summary []string
+	err     error
+}
+
+// startTrace captures an execution trace of the target for the given
+// number of seconds in the background, and sends its summary to
+// traceDone.
+func startTrace(target string, seconds int) {
+	traceCapturing = true
+	go func() {
+		summary, err := captureTrace(target, seconds)
+		traceDone <- ui.Event{Path: "/gom/trace", Data: traceResult{target, summary, err}}
+	}()
+}
+
+// captureTrace captures an execution trace of the target for the given
+// number of seconds, saves it and summarizes it. The summary is made
+// of the GC pauses during the trace, observed through the stats, and of
+// the time the goroutines spent running, runnable, blocked and in
+// syscalls, by start function and by goroutine.
+func captureTrace(target string, seconds int) ([]string, error) {
+	before, err := fetchStats(target)
+	if err != nil {
+		return nil, err
+	}
+	file, err := fetchTrace(target, seconds)
+	if err != nil {
+		return nil, err
+	}
+	after, err := fetchStats(target)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := tracestats.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace %s: %v", file, err)
+	}
+
+	items := []string{
+		fmt.Sprintf("[execution trace of %ds](fg-bold) saved to %s", seconds, file),
+		fmt.Sprintf("GC: %d cycles, %v stop-the-world pauses",
+			after.NumGC-before.NumGC, time.Duration(after.PauseNs-before.PauseNs)),
+		"",
+		fmt.Sprintf("[goroutines by start function](fg-bold) of %d", len(s.Goroutines)),
+		fmt.Sprintf("%10s %10s %10s %10s %6s  %s", "running", "runnable", "blocked", "syscall", "count", "function"),
+	}
+	for i, g := range s.Groups {
+		if i == maxTraceItems {
+			items = append(items, fmt.Sprintf("  %d more", len(s.Groups)-i))
+			break
+		}
+		items = append(items, fmt.Sprintf("%s %6d  %s", formatTimes(&g.Times), g.Count, functionOrUnknown(g.Function)))
+	}
+
+	items = append(items, "", "[goroutines](fg-bold)",
+		fmt.Sprintf("%10s %10s %10s %10s %6s  %s", "running", "runnable", "blocked", "syscall", "id", "function"))
+	for i, g := range s.Goroutines {
+		if i == maxTraceItems {
+			items = append(items, fmt.Sprintf("  %d more", len(s.Goroutines)-i))
+			break
+		}
+		items = append(items, fmt.Sprintf("%s %6d  %s", formatTimes(&g.Times), g.ID, functionOrUnknown(g.Function)))
+	}
+
+	items = append(items, "", "[blocked by reason](fg-bold)")
+	for _, r := range s.Blocked {
+		reason := r.Reason
+		if reason == "" {
+			reason = "since the start of the trace"
+		}
+		items = append(items, fmt.Sprintf("%10s  %s", formatDuration(r.Blocked), reason))
+	}
+	return items, nil
+}
+
+// maxTraceItems is the number of goroutines and groups of goroutines
+// listed in trace summaries.
+const maxTraceItems = 20
+
+func formatTimes(t *tracestats.Times) string {
+	return fmt.Sprintf("%10s %10s %10s %10s", formatDuration(t.Running), formatDuration(t.Runnable),
+		formatDuration(t.Blocked), formatDuration(t.Syscall))
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "."
+	}
+	v, unit := goreport.ScaleValue(int64(d), "nanoseconds", "minimum")
+	return fmt.Sprintf("%.2f%s", v, unit)
+}
+
+func functionOrUnknown(fn string) string {
+	if fn == "" {
+		return "(unknown)"
+	}
+	return fn
+}
+
+// fetchTrace fetches an execution trace of the target into a file.
+func fetchTrace(target string, seconds int) (string, error) {
+	url := fmt.Sprintf("%s/debug/_gom?view=trace&seconds=%d", target, seconds)
+	c := &http.Client{Timeout: time.Duration(seconds)*time.Second + 30*time.Second}
+	resp, err := c.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server response: %s", resp.Status)
+	}
+
+	dir := filepath.Join(configDir(), "traces")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, time.Now().Format("20060102-150405")+".trace")
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return file, err
+}
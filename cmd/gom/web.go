@@ -0,0 +1,304 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/rakyll/gom/internal/driver"
+	"github.com/rakyll/gom/internal/plugin"
+	"github.com/rakyll/gom/internal/profile"
+	goreport "github.com/rakyll/gom/internal/report"
+	"github.com/rakyll/gom/internal/svg"
+)
+
+var webPageTmpl = template.Must(template.New("web").Parse(webPage))
+
+// serveWeb serves the web UI on addr.
+func serveWeb(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", webIndex)
+	mux.HandleFunc("/stats", webStats)
+	mux.HandleFunc("/profiles", webProfiles)
+	mux.HandleFunc("/top", webTop)
+	mux.HandleFunc("/graph", webGraph)
+	mux.HandleFunc("/flame", webFlame)
+	mux.HandleFunc("/source", webSource)
+	log.Printf("Serving the web UI for %s on %s", *target, addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func webIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	webPageTmpl.Execute(w, struct{ Target string }{*target})
+}
+
+func webStats(w http.ResponseWriter, r *http.Request) {
+	s, err := fetchStats(*target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// webProfiles lists the profiles of the target.
+func webProfiles(w http.ResponseWriter, r *http.Request) {
+	l, err := fetchProfileList(*target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// webProfile returns a copy of the profile named by the p parameter
+// of the request, filtered with the focus, ignore, hide, tagfocus and
+// tagignore parameters, and the sample type selected for it in the
+// terminal UI. The profile is fetched if it is not loaded yet or if the
+// refresh parameter is set. Errors are reported to w.
+func webProfile(w http.ResponseWriter, r *http.Request) (*profile.Profile, string, bool) {
+	name := r.FormValue("p")
+	if !nameRx.MatchString(name) {
+		http.Error(w, fmt.Sprintf("invalid profile %q", name), http.StatusNotFound)
+		return nil, "", false
+	}
+	rpt, err := profileReport(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, "", false
+	}
+	var filters []sampleFilter
+	for _, kind := range []string{"focus", "ignore", "hide", "tagfocus", "tagignore"} {
+		expr := r.FormValue(kind)
+		if expr == "" {
+			continue
+		}
+		f, err := newFilter(kind, expr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, "", false
+		}
+		filters = append(filters, f)
+	}
+	seconds, _ := strconv.Atoi(r.FormValue("seconds"))
+	if err := rpt.fetch(r.FormValue("refresh") != "", seconds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil, "", false
+	}
+	p, _ := rpt.filtered(filters)
+	if p == nil || len(p.SampleType) == 0 {
+		http.Error(w, "profile is not available", http.StatusBadGateway)
+		return nil, "", false
+	}
+	rpt.mu.Lock()
+	stype := rpt.sampleType
+	rpt.mu.Unlock()
+	return p, stype, true
+}
+
+func webTop(w http.ResponseWriter, r *http.Request) {
+	p, stype, ok := webProfile(w, r)
+	if !ok {
+		return
+	}
+	if err := p.Aggregate(true, true, false, false, false); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rpt, err := newReport(p, stype, goreport.Options{
+		OutputFormat: goreport.JSON,
+		CumSort:      r.FormValue("cum") != "",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := goreport.Generate(&buf, rpt, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	buf.WriteTo(w)
+}
+
+// webGraph renders the call graph as SVG. It requires the dot tool of
+// Graphviz.
+func webGraph(w http.ResponseWriter, r *http.Request) {
+	p, stype, ok := webProfile(w, r)
+	if !ok {
+		return
+	}
+	rpt, err := newReport(p, stype, goreport.Options{
+		OutputFormat: goreport.Dot,
+		NodeCount:    80,
+		NodeFraction: 0.005,
+		EdgeFraction: 0.001,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var dot bytes.Buffer
+	if err := goreport.Generate(&dot, rpt, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := exec.LookPath("dot"); err != nil {
+		http.Error(w, "cannot find dot, have you installed Graphviz?", http.StatusInternalServerError)
+		return
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("dot", "-Tsvg")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &dot, &out, &stderr
+	if err := cmd.Run(); err != nil {
+		http.Error(w, fmt.Sprintf("dot: %v: %s", err, stderr.String()), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprint(w, svg.Massage(out))
+}
+
+// webSource renders the annotated source of the functions matching
+// the s parameter as HTML.
+func webSource(w http.ResponseWriter, r *http.Request) {
+	symbol, err := regexp.Compile(r.FormValue("s"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid source regexp: %v", err), http.StatusBadRequest)
+		return
+	}
+	p, stype, ok := webProfile(w, r)
+	if !ok {
+		return
+	}
+	if err := p.Aggregate(true, true, true, true, false); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rpt, err := newReport(p, stype, goreport.Options{
+		OutputFormat: goreport.WebList,
+		Symbol:       symbol,
+		SourcePath:   pathRules,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := goreport.Generate(&buf, rpt, plugin.NoObjTool()); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// flameNode is a frame of a flame graph. Its value includes the
+// values of its children.
+type flameNode struct {
+	Name     string       `json:"n"`
+	Value    int64        `json:"v"`
+	Label    string       `json:"l"`
+	Children []*flameNode `json:"c,omitempty"`
+
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(name string) *flameNode {
+	if c, ok := n.children[name]; ok {
+		return c
+	}
+	c := &flameNode{Name: name}
+	if n.children == nil {
+		n.children = make(map[string]*flameNode)
+	}
+	n.children[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// label formats the values of n and its descendants, and drops the
+// frames worth less than min.
+func (n *flameNode) label(rpt *goreport.Report, min int64) {
+	n.Label = rpt.FormatValue(n.Value)
+	var children []*flameNode
+	for _, c := range n.Children {
+		if c.Value < min {
+			continue
+		}
+		c.label(rpt, min)
+		children = append(children, c)
+	}
+	n.Children = children
+}
+
+func webFlame(w http.ResponseWriter, r *http.Request) {
+	p, stype, ok := webProfile(w, r)
+	if !ok {
+		return
+	}
+	value, _, _, err := driver.SampleValue(p, stype)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rpt, err := newReport(p, stype, goreport.Options{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	root := &flameNode{Name: "root"}
+	for _, s := range p.Sample {
+		v := value(s)
+		root.Value += v
+		n := root
+		for i := len(s.Location) - 1; i >= 0; i-- {
+			loc := s.Location[i]
+			if len(loc.Line) == 0 {
+				n = n.child(fmt.Sprintf("%#x", loc.Address))
+				n.Value += v
+				continue
+			}
+			// Lines are ordered from the innermost inlined call.
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				name := fmt.Sprintf("%#x", loc.Address)
+				if fn := loc.Line[j].Function; fn != nil {
+					name = fn.Name
+				}
+				n = n.child(name)
+				n.Value += v
+			}
+		}
+	}
+	// Frames narrower than a thousandth of the total are not visible.
+	root.label(rpt, root.Value/1000)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(root)
+}
@@ -0,0 +1,276 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// webPage is the template of the web UI. The state of the page is kept
+// in the URL fragment, so links to the page can be shared.
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gom - {{.Target}}</title>
+<style>
+body { font-family: sans-serif; margin: 0; }
+header { background: #1565c0; color: #fff; padding: 6px 10px; }
+header select, header input, header button { margin-right: 6px; }
+#stats { display: flex; padding: 6px 10px; }
+.spark { margin-right: 24px; font-size: 0.9em; }
+.spark polyline { fill: none; stroke: #00acc1; stroke-width: 1.5; }
+nav a { color: #fff; margin-right: 12px; cursor: pointer; }
+nav a.active { font-weight: bold; text-decoration: underline; }
+#msg { color: #c62828; padding: 0 10px; }
+#content { padding: 0 10px; }
+table { border-collapse: collapse; font-family: monospace; width: 100%; }
+th { text-align: right; cursor: pointer; border-bottom: 1px solid #999; }
+th.name, td.name { text-align: left; }
+td { text-align: right; padding: 1px 8px; white-space: nowrap; }
+td.name { cursor: pointer; }
+tr:hover { background: #eee; }
+iframe { border: none; width: 100%; height: 80vh; }
+.fn { overflow: hidden; }
+.fl { background: #ffab40; border: 1px solid #fff; font: 11px monospace; height: 16px;
+      white-space: nowrap; overflow: hidden; text-overflow: ellipsis; cursor: pointer; }
+.fc { display: flex; }
+</style>
+</head>
+<body>
+<header>
+  <b>gom</b> {{.Target}} &nbsp;
+  <select id="profile">
+    <option value="heap">heap</option>
+    <option value="profile">cpu</option>
+  </select>
+  <input id="focus" placeholder="focus regexp" size="30">
+  <button id="refresh">refresh</button>
+  <nav style="display: inline">
+    <a data-view="top">top</a>
+    <a data-view="graph">graph</a>
+    <a data-view="flame">flame</a>
+    <a data-view="source">source</a>
+  </nav>
+</header>
+<div id="stats"></div>
+<div id="msg"></div>
+<div id="content"></div>
+<script>
+var state = {p: "heap", view: "top", focus: "", cum: "", s: ""};
+
+function loadState() {
+  var h = location.hash.substring(1).split("&");
+  for (var i = 0; i < h.length; i++) {
+    var kv = h[i].split("=");
+    if (kv.length == 2 && kv[0] in state) {
+      state[kv[0]] = decodeURIComponent(kv[1]);
+    }
+  }
+  document.getElementById("profile").value = state.p;
+  document.getElementById("focus").value = state.focus;
+}
+
+function query(extra) {
+  var q = "p=" + encodeURIComponent(state.p) + "&focus=" + encodeURIComponent(state.focus);
+  return q + (extra || "");
+}
+
+function show(refresh) {
+  var h = [];
+  for (var k in state) {
+    if (state[k]) h.push(k + "=" + encodeURIComponent(state[k]));
+  }
+  history.replaceState(null, "", "#" + h.join("&"));
+  var links = document.querySelectorAll("nav a");
+  for (var i = 0; i < links.length; i++) {
+    links[i].className = links[i].dataset.view == state.view ? "active" : "";
+  }
+  var r = refresh ? "&refresh=1" : "";
+  var content = document.getElementById("content");
+  document.getElementById("msg").textContent = state.p == "profile" && refresh ? "collecting the CPU profile..." : "";
+  switch (state.view) {
+  case "top": showTop(content, r); break;
+  case "graph": frame(content, "graph?" + query(r)); break;
+  case "flame": showFlame(content, r); break;
+  case "source": showSource(content, r); break;
+  }
+}
+
+function fetchJSON(url, f) {
+  var req = new XMLHttpRequest();
+  req.onload = function() {
+    if (req.status != 200) {
+      document.getElementById("msg").textContent = req.responseText;
+      return;
+    }
+    document.getElementById("msg").textContent = "";
+    f(JSON.parse(req.responseText));
+  };
+  req.open("GET", url);
+  req.send();
+}
+
+// loadProfiles adds the other profiles of the target, such as its
+// custom profiles, to the profile menu.
+function loadProfiles() {
+  fetchJSON("profiles", function(profiles) {
+    var menu = document.getElementById("profile");
+    for (var i = 0; i < profiles.length; i++) {
+      var name = profiles[i].name;
+      if (name == "heap" || name == "profile") continue;
+      var o = document.createElement("option");
+      o.value = o.textContent = name;
+      menu.appendChild(o);
+    }
+    menu.value = state.p;
+  });
+}
+
+function frame(content, url) {
+  content.innerHTML = "";
+  var f = document.createElement("iframe");
+  f.src = url;
+  content.appendChild(f);
+}
+
+function showTop(content, r) {
+  fetchJSON("top?" + query(r + (state.cum ? "&cum=1" : "")), function(rows) {
+    var cols = [["flat", "flat"], ["flat_perc", "flat%"], ["flatsum_perc", "sum%"], ["cum", "cum"], ["cum_perc", "cum%"]];
+    var t = document.createElement("table");
+    var hr = t.insertRow();
+    cols.forEach(function(c) {
+      var th = document.createElement("th");
+      th.textContent = c[1];
+      th.onclick = function() {
+        state.cum = c[0].indexOf("cum") == 0 ? "1" : "";
+        show();
+      };
+      hr.appendChild(th);
+    });
+    var th = document.createElement("th");
+    th.className = "name";
+    th.textContent = "name";
+    hr.appendChild(th);
+    (rows || []).forEach(function(row) {
+      var tr = t.insertRow();
+      cols.forEach(function(c) { tr.insertCell().textContent = row[c[0]]; });
+      var td = tr.insertCell();
+      td.className = "name";
+      td.textContent = row.name;
+      td.title = "show source";
+      td.onclick = function() {
+        state.view = "source";
+        var name = row.name.replace(/ \(inline\)$/, "");
+        state.s = "^" + name.replace(/[.*+?^${}()|[\]\\]/g, "\\$&") + "$";
+        show();
+      };
+    });
+    content.innerHTML = "";
+    content.appendChild(t);
+  });
+}
+
+function showSource(content, r) {
+  if (!state.s) {
+    content.innerHTML = "Select a function in the top view to list its source.";
+    return;
+  }
+  frame(content, "source?" + query(r + "&s=" + encodeURIComponent(state.s)));
+}
+
+function showFlame(content, r) {
+  fetchJSON("flame?" + query(r), function(root) {
+    content.innerHTML = "";
+    content.appendChild(flame(root, root.v));
+  });
+}
+
+function flame(n, parent) {
+  var d = document.createElement("div");
+  d.className = "fn";
+  d.style.width = (parent > 0 ? 100 * n.v / parent : 100) + "%";
+  var l = document.createElement("div");
+  l.className = "fl";
+  l.textContent = n.n;
+  l.title = n.n + " (" + n.l + ")";
+  l.onclick = function(e) {
+    e.stopPropagation();
+    var content = document.getElementById("content");
+    content.innerHTML = "";
+    content.appendChild(flame(n, n.v));
+  };
+  d.appendChild(l);
+  var c = document.createElement("div");
+  c.className = "fc";
+  (n.c || []).sort(function(a, b) { return a.n < b.n ? -1 : 1; }).forEach(function(ch) {
+    c.appendChild(flame(ch, n.v));
+  });
+  d.appendChild(c);
+  return d;
+}
+
+var series = {goroutine: [], thread: []};
+
+function sparkline(name, data) {
+  var w = 240, h = 32, max = Math.max.apply(null, data.concat([1]));
+  var pts = data.map(function(v, i) {
+    return (i * w / 120).toFixed(1) + "," + (h - v * h / max).toFixed(1);
+  }).join(" ");
+  return '<div class="spark">' + name + " (" + data[data.length - 1] + ')<br>' +
+    '<svg width="' + w + '" height="' + h + '"><polyline points="' + pts + '"/></svg></div>';
+}
+
+function pollStats() {
+  var req = new XMLHttpRequest();
+  req.onload = function() {
+    if (req.status != 200) return;
+    var s = JSON.parse(req.responseText);
+    var html = "";
+    for (var k in series) {
+      series[k].push(s[k]);
+      if (series[k].length > 120) series[k].shift();
+      html += sparkline(k + "s", series[k]);
+    }
+    document.getElementById("stats").innerHTML = html;
+  };
+  req.open("GET", "stats");
+  req.send();
+}
+
+document.getElementById("profile").onchange = function() {
+  state.p = this.value;
+  show();
+};
+document.getElementById("focus").onchange = function() {
+  state.focus = this.value;
+  show();
+};
+document.getElementById("refresh").onclick = function() {
+  show(true);
+};
+var links = document.querySelectorAll("nav a");
+for (var i = 0; i < links.length; i++) {
+  links[i].onclick = function() {
+    state.view = this.dataset.view;
+    show();
+  };
+}
+
+loadState();
+loadProfiles();
+show();
+pollStats();
+setInterval(pollStats, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,194 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// An Agent pushes the stats and the profiles of the program to a gom
+// collector, started with gom collect. It is for the programs gom
+// cannot reach, such as batch jobs and workers behind NAT.
+type Agent struct {
+	// Collector is the URL of the collector, e.g. http://collector:7070.
+	Collector string
+
+	// Service and Instance identify the program on the collector.
+	// Instance defaults to hostname-pid.
+	Service, Instance string
+
+	// StatsInterval is the interval between the pushes of the stats,
+	// 10s by default.
+	StatsInterval time.Duration
+
+	// ProfileInterval is the interval between the pushes of the
+	// profiles, 1m by default.
+	ProfileInterval time.Duration
+
+	// Profiles are the names of the profiles pushed, heap and
+	// goroutine by default.
+	Profiles []string
+
+	// CPUSeconds is the duration of the CPU profile pushed along with
+	// the other profiles. If zero, no CPU profile is pushed.
+	CPUSeconds int
+
+	// ErrorLog logs the errors pushing to the collector, if not nil.
+	ErrorLog *log.Logger
+
+	// Client is the client used to push, http.DefaultClient if nil.
+	Client *http.Client
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Start starts pushing the stats and the profiles to the collector in
+// the background.
+func (a *Agent) Start() error {
+	if a.Collector == "" || a.Service == "" {
+		return errors.New("gom agent: no collector or service")
+	}
+	if a.Instance == "" {
+		host, _ := os.Hostname()
+		a.Instance = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if a.StatsInterval <= 0 {
+		a.StatsInterval = 10 * time.Second
+	}
+	if a.ProfileInterval <= 0 {
+		a.ProfileInterval = time.Minute
+	}
+	if a.Profiles == nil {
+		a.Profiles = []string{"heap", "goroutine"}
+	}
+	a.stop = make(chan struct{})
+	a.wg.Add(2)
+	go a.loop(a.StatsInterval, a.pushStats)
+	go a.loop(a.ProfileInterval, func() { a.pushProfiles(true) })
+	return nil
+}
+
+// Stop stops pushing, and pushes the stats and the profiles but the CPU
+// profile one last time. Batch jobs should call it before exiting. It
+// does nothing if the agent is not started.
+func (a *Agent) Stop() {
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	a.wg.Wait()
+	a.stop = nil
+	a.pushStats()
+	a.pushProfiles(false)
+}
+
+func (a *Agent) loop(interval time.Duration, push func()) {
+	defer a.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		push()
+		select {
+		case <-t.C:
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+func (a *Agent) pushStats() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	b, err := json.Marshal(readStats(&ms))
+	if err != nil {
+		a.logf("gom agent: %v", err)
+		return
+	}
+	a.push("stats", "", bytes.NewReader(b))
+}
+
+func (a *Agent) pushProfiles(cpu bool) {
+	for _, name := range a.Profiles {
+		p := pprof.Lookup(name)
+		if p == nil {
+			a.logf("gom agent: unknown profile %s", name)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := p.WriteTo(&buf, 0); err != nil {
+			a.logf("gom agent: %v", err)
+			continue
+		}
+		a.push("profile", name, &buf)
+	}
+	if !cpu || a.CPUSeconds <= 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		// The CPU profile is already being collected.
+		a.logf("gom agent: %v", err)
+		return
+	}
+	select {
+	case <-time.After(time.Duration(a.CPUSeconds) * time.Second):
+	case <-a.stop:
+	}
+	pprof.StopCPUProfile()
+	a.push("profile", "profile", &buf)
+}
+
+// push posts data of the given kind, stats or profile, to the
+// collector.
+func (a *Agent) push(kind, name string, data io.Reader) {
+	u := fmt.Sprintf("%s/%s/%s/push/%s", a.Collector, url.PathEscape(a.Service), url.PathEscape(a.Instance), kind)
+	if name != "" {
+		u += "?name=" + url.QueryEscape(name)
+	}
+	c := a.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Post(u, "application/octet-stream", data)
+	if err != nil {
+		a.logf("gom agent: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		a.logf("gom agent: pushing %s %s: %s %s", kind, name, resp.Status, bytes.TrimSpace(msg))
+	}
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.ErrorLog != nil {
+		a.ErrorLog.Printf(format, args...)
+	}
+}
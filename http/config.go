@@ -0,0 +1,197 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRevert is the longest time the rates can be changed for.
+const maxRevert = 24 * time.Hour
+
+// rates are the profiling rates of the program.
+type rates struct {
+	MemProfileRate   int   `json:"mem_profile_rate"`
+	BlockProfileRate int   `json:"block_profile_rate"`
+	MutexFraction    int   `json:"mutex_fraction"`
+	RevertAt         int64 `json:"revert_at,omitempty"` // unix time the rates are reverted at
+}
+
+var config struct {
+	mu    sync.Mutex
+	token string
+
+	// blockRate is the block profile rate last set, as the runtime
+	// does not report it.
+	blockRate int
+
+	// saved are the rates to revert to, or nil if the rates are not
+	// changed temporarily. The block profile rate is only reverted if
+	// blockChanged, so as not to reset the rate set by the program.
+	saved        *rates
+	blockChanged bool
+	revertAt     time.Time
+	timer        *time.Timer
+}
+
+// EnableConfig enables the view=config parameter of the handler, to get
+// and set the memory profile rate, the block profile rate and the mutex
+// profile fraction of the program. Requests must send the token in an
+// "Authorization: Bearer <token>" header.
+//
+// A POST sets the rates given by the mem_profile_rate,
+// block_profile_rate and mutex_fraction parameters for the number of
+// seconds of the revert parameter, 5 minutes by default, after which
+// the previous rates are restored; the reset parameter restores them
+// right away. The block profile rate, which the runtime does not
+// report, is only changed and restored when given. Note that changing
+// the memory profile rate skews the memory in use reported for the
+// allocations made before.
+func EnableConfig(token string) {
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	config.token = token
+}
+
+func serveConfig(w http.ResponseWriter, r *http.Request) {
+	config.mu.Lock()
+	defer config.mu.Unlock()
+	if config.token == "" {
+		http.Error(w, "config is not enabled", http.StatusForbidden)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(config.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := setRates(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	cur := currentRates()
+	if config.saved != nil {
+		cur.RevertAt = config.revertAt.Unix()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cur)
+}
+
+// currentRates returns the rates of the program. config.mu must be
+// held.
+func currentRates() *rates {
+	return &rates{
+		MemProfileRate:   runtime.MemProfileRate,
+		BlockProfileRate: config.blockRate,
+		MutexFraction:    runtime.SetMutexProfileFraction(-1),
+	}
+}
+
+// setRates sets the rates of the request, and schedules their revert.
+// config.mu must be held.
+func setRates(r *http.Request) error {
+	if r.FormValue("reset") != "" {
+		revertRates()
+		return nil
+	}
+	revert := 5 * time.Minute
+	if s := r.FormValue("revert"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || time.Duration(n)*time.Second > maxRevert {
+			return fmt.Errorf("invalid revert parameter %q", s)
+		}
+		revert = time.Duration(n) * time.Second
+	}
+	next := currentRates()
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{
+		{"mem_profile_rate", &next.MemProfileRate},
+		{"block_profile_rate", &next.BlockProfileRate},
+		{"mutex_fraction", &next.MutexFraction},
+	} {
+		s := r.FormValue(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s parameter %q", p.name, s)
+		}
+		*p.v = n
+	}
+
+	// Later changes are reverted to the rates before the first one.
+	if config.saved == nil {
+		config.saved = currentRates()
+	}
+	block := r.FormValue("block_profile_rate") != ""
+	config.blockChanged = config.blockChanged || block
+	applyRates(next, block)
+	config.revertAt = time.Now().Add(revert)
+	if config.timer != nil {
+		config.timer.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(revert, func() {
+		config.mu.Lock()
+		defer config.mu.Unlock()
+		// The rates may have been changed again since.
+		if config.timer == t {
+			revertRates()
+		}
+	})
+	config.timer = t
+	return nil
+}
+
+// revertRates restores the rates saved before they were changed.
+// config.mu must be held.
+func revertRates() {
+	if config.timer != nil {
+		config.timer.Stop()
+		config.timer = nil
+	}
+	if config.saved == nil {
+		return
+	}
+	applyRates(config.saved, config.blockChanged)
+	config.saved = nil
+	config.blockChanged = false
+}
+
+// applyRates sets the rates, and the block profile rate only if block
+// is set.
+func applyRates(r *rates, block bool) {
+	runtime.MemProfileRate = r.MemProfileRate
+	if block {
+		runtime.SetBlockProfileRate(r.BlockProfileRate)
+		config.blockRate = r.BlockProfileRate
+	}
+	runtime.SetMutexProfileFraction(r.MutexFraction)
+}
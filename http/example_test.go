@@ -17,6 +17,7 @@ package http_test
 import (
 	"log"
 	"net/http"
+	"os"
 
 	gomhttp "github.com/rakyll/gom/http"
 )
@@ -26,3 +27,47 @@ func Example_gorillaMux() {
 	mux.HandleFunc("/debug/_gom", gomhttp.Handler())
 	log.Println(http.ListenAndServe("localhost:6060", nil))
 }
+
+func ExampleMetricsHandler() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/_gom", gomhttp.Handler())
+	mux.HandleFunc("/debug/_gom/metrics", gomhttp.MetricsHandler())
+	log.Println(http.ListenAndServe("localhost:6060", mux))
+}
+
+func ExampleAgent() {
+	agent := &gomhttp.Agent{
+		Collector:  "http://collector:7070",
+		Service:    "worker",
+		CPUSeconds: 10,
+	}
+	if err := agent.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer agent.Stop()
+
+	// Do the work.
+}
+
+func ExampleGoroutineLeaks() {
+	before, err := gomhttp.CaptureGoroutines()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Run the code that should leave no goroutines behind.
+
+	after, err := gomhttp.CaptureGoroutines()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range gomhttp.GoroutineLeaks(before, after) {
+		log.Println(l)
+	}
+}
+
+func ExampleEnableConfig() {
+	// Let gom change the profiling rates with :rate, given the token.
+	gomhttp.EnableConfig(os.Getenv("GOM_TOKEN"))
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime"
 	"runtime/pprof"
 	"time"
 
@@ -25,18 +26,30 @@ import (
 )
 
 type stats struct {
-	Goroutine int   `json:"goroutine"`
-	Thread    int   `json:"thread"`
-	Block     int   `json:"block"`
-	Timestamp int64 `json:"timestamp"`
+	Goroutine int    `json:"goroutine"`
+	Thread    int    `json:"thread"`
+	Block     int    `json:"block"`
+	HeapAlloc uint64 `json:"heap_alloc"`
+	NumGC     uint32 `json:"num_gc"`
+	PauseNs   uint64 `json:"pause_ns"` // total GC stop-the-world pause time
+	Timestamp int64  `json:"timestamp"`
+}
+
+// A profileInfo describes a profile listed by the handler.
+type profileInfo struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
 }
 
 func init() {
 	http.HandleFunc("/debug/_gom", Handler())
+	http.HandleFunc("/debug/_gom/metrics", MetricsHandler())
 }
 
 // Handler returns an http.HandlerFunc that returns pprof profiles
-// and additional metrics.
+// and additional metrics. The view=list parameter lists the profiles,
+// including the custom profiles created with pprof.NewProfile, with
+// their counts. See EnableConfig for the view=config parameter.
 // The handler must be accessible through the "/debug/_gom" route
 // in order for gom to display the stats from the debugged program.
 // See the godoc examples for usage.
@@ -55,17 +68,40 @@ func Handler() http.HandlerFunc {
 		case "symbol":
 			httppprof.Symbol(w, r)
 			return
+		case "trace":
+			httppprof.Trace(w, r)
+			return
+		case "config":
+			serveConfig(w, r)
+			return
+		case "list":
+			var l []profileInfo
+			for _, p := range pprof.Profiles() {
+				l = append(l, profileInfo{Name: p.Name(), Count: p.Count()})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(l)
+			return
 		}
-		n := &stats{
-			Goroutine: pprof.Lookup("goroutine").Count(),
-			Thread:    pprof.Lookup("threadcreate").Count(),
-			Block:     pprof.Lookup("block").Count(),
-			Timestamp: time.Now().Unix(),
-		}
-		err := json.NewEncoder(w).Encode(n)
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		err := json.NewEncoder(w).Encode(readStats(&ms))
 		if err != nil {
 			w.WriteHeader(500)
 			fmt.Fprint(w, err)
 		}
 	}
 }
+
+// readStats reads the stats of the program, given its memory stats.
+func readStats(ms *runtime.MemStats) *stats {
+	return &stats{
+		Goroutine: pprof.Lookup("goroutine").Count(),
+		Thread:    pprof.Lookup("threadcreate").Count(),
+		Block:     pprof.Lookup("block").Count(),
+		HeapAlloc: ms.HeapAlloc,
+		NumGC:     ms.NumGC,
+		PauseNs:   ms.PauseTotalNs,
+		Timestamp: time.Now().Unix(),
+	}
+}
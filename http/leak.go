@@ -0,0 +1,93 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+
+	"github.com/rakyll/gom/internal/goroutine"
+)
+
+// A GoroutineSnapshot is the goroutines of the program at some point,
+// grouped by stack.
+type GoroutineSnapshot struct {
+	s goroutine.Snapshot
+}
+
+// CaptureGoroutines captures the goroutines of the program.
+func CaptureGoroutines() (*GoroutineSnapshot, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return nil, err
+	}
+	s, err := goroutine.Parse(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	// Leave out the goroutine capturing the snapshot, whose stack
+	// differs from one capture to the next.
+	for key, g := range s {
+		if len(g.Stack) > 0 && strings.HasPrefix(g.Stack[0], "runtime/pprof.") {
+			delete(s, key)
+		}
+	}
+	return &GoroutineSnapshot{s}, nil
+}
+
+// A GoroutineLeak is a stack whose goroutines keep growing in number.
+type GoroutineLeak struct {
+	// Stack is the functions of the stack, innermost first.
+	Stack []string
+
+	// CreatedBy is the function that created the goroutines.
+	CreatedBy string
+
+	// Counts are the number of goroutines of the stack in each
+	// snapshot.
+	Counts []int
+}
+
+func (l *GoroutineLeak) String() string {
+	return fmt.Sprintf("goroutines created by %s in %s grew from %d to %d",
+		l.CreatedBy, strings.Join(l.Stack, " < "), l.Counts[0], l.Counts[len(l.Counts)-1])
+}
+
+// GoroutineLeaks returns the stacks whose goroutines grew monotonically
+// over the snapshots, oldest first, by decreasing growth. Tests can
+// check they leave no goroutines behind:
+//
+//	before, _ := gomhttp.CaptureGoroutines()
+//	// Run the code under test.
+//	after, _ := gomhttp.CaptureGoroutines()
+//	for _, l := range gomhttp.GoroutineLeaks(before, after) {
+//		t.Error(l)
+//	}
+//
+// Goroutines exiting asynchronously may need some time to do so before
+// the last snapshot is captured.
+func GoroutineLeaks(snapshots ...*GoroutineSnapshot) []*GoroutineLeak {
+	var ss []goroutine.Snapshot
+	for _, s := range snapshots {
+		ss = append(ss, s.s)
+	}
+	var leaks []*GoroutineLeak
+	for _, g := range goroutine.Growing(ss...) {
+		leaks = append(leaks, &GoroutineLeak{Stack: g.Stack, CreatedBy: g.CreatedBy, Counts: g.Counts})
+	}
+	return leaks
+}
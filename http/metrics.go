@@ -0,0 +1,190 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultTopSites is the number of allocation sites exposed by
+// MetricsHandler, unless the top parameter says otherwise.
+const defaultTopSites = 10
+
+// MetricsHandler returns an http.HandlerFunc that exposes the stats
+// of the program in the Prometheus text format, along with the memory
+// in use by its top allocation sites, as the heap profile reports
+// them. The number of allocation sites is set by the top parameter,
+// 10 by default.
+// The handler is registered to "/debug/_gom/metrics" on the
+// http.DefaultServeMux.
+func MetricsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		top := defaultTopSites
+		if t := r.URL.Query().Get("top"); t != "" {
+			n, err := strconv.Atoi(t)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid top parameter", http.StatusBadRequest)
+				return
+			}
+			top = n
+		}
+
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		s := readStats(&ms)
+
+		var buf bytes.Buffer
+		gauge := func(name, help string, v float64) {
+			metric(&buf, name, "gauge", help)
+			fmt.Fprintf(&buf, "%s %v\n", name, v)
+		}
+		counter := func(name, help string, v float64) {
+			metric(&buf, name, "counter", help)
+			fmt.Fprintf(&buf, "%s %v\n", name, v)
+		}
+		gauge("gom_goroutines", "Number of goroutines.", float64(s.Goroutine))
+		gauge("gom_threads", "Number of threads created.", float64(s.Thread))
+		gauge("gom_block_profile_stacks", "Number of stacks in the block profile.", float64(s.Block))
+		gauge("gom_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(ms.HeapAlloc))
+		gauge("gom_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(ms.HeapInuse))
+		gauge("gom_heap_objects", "Number of allocated heap objects.", float64(ms.HeapObjects))
+		gauge("gom_sys_bytes", "Bytes of memory obtained from the OS.", float64(ms.Sys))
+		counter("gom_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC))
+		counter("gom_gc_pause_seconds_total", "Total GC stop-the-world pause time.", float64(ms.PauseTotalNs)/1e9)
+
+		sites := readAllocationSites()
+		if len(sites) > top {
+			sites = sites[:top]
+		}
+		metric(&buf, "gom_top_inuse_space_bytes", "gauge", "Bytes in use allocated by the top allocation sites, as of the last GC.")
+		for _, a := range sites {
+			fmt.Fprintf(&buf, "gom_top_inuse_space_bytes{function=\"%s\"} %d\n", escapeLabel(a.function), a.bytes)
+		}
+		metric(&buf, "gom_top_inuse_objects", "gauge", "Objects in use allocated by the top allocation sites, as of the last GC.")
+		for _, a := range sites {
+			fmt.Fprintf(&buf, "gom_top_inuse_objects{function=\"%s\"} %d\n", escapeLabel(a.function), a.objects)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
+
+func metric(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// escapeLabel escapes a label value of the Prometheus text format.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// An allocationSite is a function allocating heap memory.
+type allocationSite struct {
+	function       string
+	bytes, objects int64
+}
+
+type allocationSites []*allocationSite
+
+func (a allocationSites) Len() int      { return len(a) }
+func (a allocationSites) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a allocationSites) Less(i, j int) bool {
+	if a[i].bytes != a[j].bytes {
+		return a[i].bytes > a[j].bytes
+	}
+	return a[i].function < a[j].function
+}
+
+// readAllocationSites returns the functions allocating the memory in use,
+// by decreasing bytes in use. The functions of the runtime package are
+// attributed to their callers.
+func readAllocationSites() allocationSites {
+	var records []runtime.MemProfileRecord
+	n, _ := runtime.MemProfile(nil, false)
+	for {
+		// Allow room for a few more records between the calls.
+		records = make([]runtime.MemProfileRecord, n+50)
+		var ok bool
+		if n, ok = runtime.MemProfile(records, false); ok {
+			records = records[:n]
+			break
+		}
+	}
+
+	sites := make(map[string]*allocationSite)
+	for _, r := range records {
+		objects, bytes := scaleHeapSample(r.InUseObjects(), r.InUseBytes(), int64(runtime.MemProfileRate))
+		if bytes == 0 {
+			continue
+		}
+		fn := allocationFunction(r.Stack())
+		a, ok := sites[fn]
+		if !ok {
+			a = &allocationSite{function: fn}
+			sites[fn] = a
+		}
+		a.bytes += bytes
+		a.objects += objects
+	}
+	var s allocationSites
+	for _, a := range sites {
+		s = append(s, a)
+	}
+	sort.Sort(s)
+	return s
+}
+
+// allocationFunction returns the first function of stk outside of the
+// runtime package.
+func allocationFunction(stk []uintptr) string {
+	frames := runtime.CallersFrames(stk)
+	name := "unknown"
+	for {
+		f, more := frames.Next()
+		if f.Function != "" {
+			name = f.Function
+			if !strings.HasPrefix(name, "runtime.") {
+				break
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return name
+}
+
+// scaleHeapSample unsamples the heap allocations of a memory profile
+// record, as the heap profile does. Memory profiles sample one
+// allocation every rate bytes on average.
+func scaleHeapSample(count, size, rate int64) (int64, int64) {
+	if count == 0 || size == 0 {
+		return 0, 0
+	}
+	if rate <= 1 {
+		return count, size
+	}
+	avgSize := float64(size) / float64(count)
+	scale := 1 / (1 - math.Exp(-avgSize/float64(rate)))
+	return int64(float64(count) * scale), int64(float64(size) * scale)
+}
@@ -247,13 +247,27 @@ func compileTagFilter(filter string, ui plugin.UI) (f func(string, string, int64
 	if filter == "" {
 		return nil, nil
 	}
-	if numFilter := parseTagFilterRange(filter); numFilter != nil {
+	if parseTagFilterRange(filter) != nil {
 		ui.PrintErr("Interpreted '", filter, "' as range, not regexp")
-		return func(key, val string, num int64) bool {
-			if val != "" {
+	}
+	return TagFilter("", filter)
+}
+
+// TagFilter compiles a filter on the tags of samples. The filter is
+// either a regexp matched against key:value strings of the string
+// tags, or a range of values of numeric tags, such as 4mb: or
+// 12kb:64mb. If key is not empty, the filter only matches the tags
+// with the given key, and regexps are matched against their values.
+func TagFilter(key, filter string) (profile.TagMatch, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	if numFilter := parseTagFilterRange(filter); numFilter != nil {
+		return func(k, val string, num int64) bool {
+			if val != "" || key != "" && k != key {
 				return false
 			}
-			return numFilter(num, key)
+			return numFilter(num, k)
 		}, nil
 	}
 	fx, err := regexp.Compile(filter)
@@ -261,11 +275,14 @@ func compileTagFilter(filter string, ui plugin.UI) (f func(string, string, int64
 		return nil, err
 	}
 
-	return func(key, val string, num int64) bool {
+	return func(k, val string, num int64) bool {
 		if val == "" {
 			return false
 		}
-		return fx.MatchString(key + ":" + val)
+		if key != "" {
+			return k == key && fx.MatchString(val)
+		}
+		return fx.MatchString(k + ":" + val)
 	}, nil
 }
 
@@ -883,6 +900,7 @@ var usageMsg = "Output file parameters (for file-based output formats):\n" +
 	"  -ignore=r         Skips paths going through any nodes matching regexp\n" +
 	"  -tagfocus=r       Restrict to samples tagged with key:value matching regexp\n" +
 	"                    Restrict to samples with numeric tags in range (eg \"32kb:1mb\")\n" +
+	"                    Restrict to samples with tag key matching key=r (eg \"route=^/api\")\n" +
 	"  -tagignore=r      Discard samples tagged with key:value matching regexp\n" +
 	"                    Avoid samples with numeric tags in range (eg \"1mb:\")\n" +
 	"Miscellaneous:\n" +
@@ -919,6 +937,65 @@ func aggregate(prof *profile.Profile, f *flags) error {
 	return nil
 }
 
+// Granularities lists the granularities supported by Aggregate.
+var Granularities = []string{"functions", "files", "lines", "addresses", "packages"}
+
+// Aggregate aggregates the samples of prof at the given granularity,
+// one of Granularities. The packages granularity aggregates functions
+// by their Go import path.
+func Aggregate(prof *profile.Profile, granularity string) error {
+	switch granularity {
+	case "functions":
+		return prof.Aggregate(true, true, false, false, false)
+	case "files":
+		return prof.Aggregate(true, false, true, false, false)
+	case "lines":
+		return prof.Aggregate(true, true, true, true, false)
+	case "addresses":
+		return nil
+	case "packages":
+		for _, f := range prof.Function {
+			f.Name = packageName(f.Name)
+			f.SystemName = f.Name
+			f.StartLine = 0
+		}
+		// Merge the calls inlined within a package.
+		for _, l := range prof.Location {
+			var lines []profile.Line
+			for _, ln := range l.Line {
+				if n := len(lines); n > 0 && ln.Function != nil && lines[n-1].Function != nil &&
+					lines[n-1].Function.Name == ln.Function.Name {
+					lines[n-1] = ln
+					continue
+				}
+				lines = append(lines, ln)
+			}
+			l.Line = lines
+		}
+		return prof.Aggregate(true, true, false, false, false)
+	}
+	return fmt.Errorf("unknown granularity %s, expected one of %s", granularity, strings.Join(Granularities, ", "))
+}
+
+// packageRx matches the import path of the package of a Go function
+// name, followed by a dot. The last element of the path may end with
+// versions, as in gopkg.in/yaml.v2.
+var packageRx = regexp.MustCompile(`^((?:.*/)?[^./]*(?:\.v[0-9]+)*)\.`)
+
+// packageName returns the import path of the package of a Go function
+// name, such as encoding/json for encoding/json.(*decodeState).object.
+// The type arguments of generic functions, which may hold import paths
+// of their own, are ignored.
+func packageName(fn string) string {
+	if i := strings.Index(fn, "["); i != -1 {
+		fn = fn[:i]
+	}
+	if m := packageRx.FindStringSubmatch(fn); m != nil {
+		return m[1]
+	}
+	return fn
+}
+
 // parseOptions parses the options into report.Options
 // Returns a function to postprocess the report after generation.
 func parseOptions(f *flags) (o *report.Options, p commands.PostProcessor, err error) {
@@ -976,6 +1053,73 @@ func sampleFormat(p *profile.Profile, f *flags) (sampleValueFunc, string, string
 	return valueExtractor(valueIndex), p.SampleType[valueIndex].Type, p.SampleType[valueIndex].Unit
 }
 
+// SampleValue returns a function extracting the values of the sample
+// type named t from the samples of p, along with the type and the unit
+// of the values. The mean_ prefix selects the mean value per event, as
+// the -mean option does. If t is empty, the last sample type of p is
+// used, as in reports by default.
+func SampleValue(p *profile.Profile, t string) (value func(*profile.Sample) int64, stype, unit string, err error) {
+	if len(p.SampleType) == 0 {
+		return nil, "", "", fmt.Errorf("profile has no sample types")
+	}
+	if t == "" {
+		ix := len(p.SampleType) - 1
+		return valueExtractor(ix), p.SampleType[ix].Type, p.SampleType[ix].Unit, nil
+	}
+	mean := strings.HasPrefix(t, "mean_")
+	name := strings.TrimPrefix(t, "mean_")
+	for ix, st := range p.SampleType {
+		if st.Type != name {
+			continue
+		}
+		if !mean {
+			return valueExtractor(ix), st.Type, st.Unit, nil
+		}
+		if cx := countIndex(p, ix); cx != -1 {
+			return ratioExtractor(ix, cx), t, st.Unit, nil
+		}
+	}
+	return nil, "", "", fmt.Errorf("sample type %s not valid for this profile; valid types are %s",
+		t, strings.Join(SampleTypes(p), ", "))
+}
+
+// SampleTypes returns the sample types of p that can be passed to
+// SampleValue, including the mean variants of the types that have
+// event counts.
+func SampleTypes(p *profile.Profile) []string {
+	var types, means []string
+	for ix, st := range p.SampleType {
+		types = append(types, st.Type)
+		if countIndex(p, ix) != -1 {
+			means = append(means, "mean_"+st.Type)
+		}
+	}
+	return append(types, means...)
+}
+
+// countIndex returns the index of the sample type counting the events
+// measured by the sample type ix, or -1 if there is none. The
+// space of heap profiles is counted by the objects of the same kind,
+// and other types by the first sample type if it is a count.
+func countIndex(p *profile.Profile, ix int) int {
+	st := p.SampleType[ix]
+	if st.Unit == "count" {
+		return -1
+	}
+	if strings.HasSuffix(st.Type, "_space") {
+		objects := strings.TrimSuffix(st.Type, "_space") + "_objects"
+		for cx, ct := range p.SampleType {
+			if ct.Type == objects {
+				return cx
+			}
+		}
+	}
+	if p.SampleType[0].Unit == "count" {
+		return 0
+	}
+	return -1
+}
+
 func valueExtractor(ix int) sampleValueFunc {
 	return func(s *profile.Sample) int64 {
 		return s.Value[ix]
@@ -991,6 +1135,17 @@ func meanExtractor(ix int) sampleValueFunc {
 	}
 }
 
+// ratioExtractor returns the value ix of samples divided by the value
+// cx.
+func ratioExtractor(ix, cx int) sampleValueFunc {
+	return func(s *profile.Sample) int64 {
+		if s.Value[cx] == 0 {
+			return 0
+		}
+		return s.Value[ix] / s.Value[cx]
+	}
+}
+
 func generate(interactive bool, prof *profile.Profile, obj plugin.ObjTool, ui plugin.UI, f *flags) error {
 	o, postProcess, err := parseOptions(f)
 	if err != nil {
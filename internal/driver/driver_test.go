@@ -0,0 +1,38 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import "testing"
+
+func TestPackageName(t *testing.T) {
+	for _, tt := range []struct {
+		fn, want string
+	}{
+		{"main.main", "main"},
+		{"encoding/json.(*decodeState).object", "encoding/json"},
+		{"github.com/rakyll/gom/internal/driver.packageName", "github.com/rakyll/gom/internal/driver"},
+		{"gopkg.in/yaml.v2.Unmarshal", "gopkg.in/yaml.v2"},
+		{"gopkg.in/yaml.v2.(*decoder).unmarshal", "gopkg.in/yaml.v2"},
+		{"gopkg.in/check.v1.(*C).Assert.func1", "gopkg.in/check.v1"},
+		{"example.com/p.F[go.shape.*example.com/x.T]", "example.com/p"},
+		{"example.com/p.(*List[go.shape.string]).Push", "example.com/p"},
+		{"slices.SortFunc[go.shape.[]*example.com/x.T,go.shape.*uint8]", "slices"},
+		{"runtime", "runtime"},
+	} {
+		if got := packageName(tt.fn); got != tt.want {
+			t.Errorf("packageName(%q) = %q, want %q", tt.fn, got, tt.want)
+		}
+	}
+}
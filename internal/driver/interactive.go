@@ -24,10 +24,26 @@ var profileFunctionNames = []string{}
 // it returns unchanged substring. It defaults to no-op if the profile
 // is not specified.
 func functionCompleter(substring string) string {
+	return completeFunction(profileFunctionNames, substring)
+}
+
+// FunctionCompleter returns a completer replacing the provided
+// substring with the name of a function of p if a single match exists.
+func FunctionCompleter(p *profile.Profile) commands.Completer {
+	var names []string
+	for _, fn := range p.Function {
+		names = append(names, fn.Name)
+	}
+	return func(substring string) string {
+		return completeFunction(names, substring)
+	}
+}
+
+func completeFunction(names []string, substring string) string {
 	found := ""
-	for _, fName := range profileFunctionNames {
+	for _, fName := range names {
 		if strings.Contains(fName, substring) {
-			if found != "" {
+			if found != "" && found != fName {
 				return substring
 			}
 			found = fName
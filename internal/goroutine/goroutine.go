@@ -0,0 +1,170 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package goroutine parses goroutine dumps and finds the stacks whose
+// goroutines keep growing in number, a sign of goroutine leaks.
+package goroutine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Group is a set of goroutines with the same stack.
+type Group struct {
+	// Stack is the functions of the stack, innermost first.
+	Stack []string
+
+	// CreatedBy is the function that created the goroutines, empty
+	// for the main goroutine.
+	CreatedBy string
+
+	// Count is the number of goroutines.
+	Count int
+
+	// key identifies the stack, with the positions of its frames.
+	key string
+}
+
+// A Snapshot is the goroutines of a program at some point, grouped by
+// stack.
+type Snapshot map[string]*Group
+
+// Parse parses a goroutine dump, as written by the goroutine profile
+// with debug=2 or by runtime.Stack for all the goroutines.
+func Parse(b []byte) (Snapshot, error) {
+	s := make(Snapshot)
+	var g *Group
+	var frames []string
+	var createdBy bool
+	flush := func() {
+		if g == nil {
+			return
+		}
+		g.key = strings.Join(frames, "\n")
+		if old, ok := s[g.key]; ok {
+			old.Count++
+		} else {
+			g.Count = 1
+			s[g.key] = g
+		}
+		g = nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, ":"):
+			flush()
+			g, frames, createdBy = &Group{}, nil, false
+		case g == nil || line == "" || strings.HasPrefix(line, "..."):
+		case strings.HasPrefix(line, "\t"):
+			// The position of the last function, minus its pc offset.
+			pos := strings.TrimSpace(line)
+			if i := strings.LastIndex(pos, " +0x"); i >= 0 {
+				pos = pos[:i]
+			}
+			frames = append(frames, pos)
+		case strings.HasPrefix(line, "created by "):
+			fn := strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(fn, " in goroutine "); i >= 0 {
+				fn = fn[:i]
+			}
+			g.CreatedBy = fn
+			// Goroutines of the same stack are grouped whatever
+			// goroutine created them.
+			frames = append(frames, "created by "+fn)
+			createdBy = true
+		case createdBy:
+			return nil, fmt.Errorf("malformed goroutine dump: frame after the creator: %q", line)
+		default:
+			fn := line
+			if strings.HasSuffix(fn, ")") {
+				if i := strings.LastIndex(fn, "("); i > 0 {
+					fn = fn[:i]
+				}
+			}
+			g.Stack = append(g.Stack, fn)
+			frames = append(frames, fn)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if len(s) == 0 && len(bytes.TrimSpace(b)) > 0 {
+		return nil, fmt.Errorf("not a goroutine dump")
+	}
+	return s, nil
+}
+
+// A Growth is a stack whose goroutines grew in number over snapshots.
+type Growth struct {
+	*Group
+
+	// Counts are the number of goroutines of the stack in each
+	// snapshot.
+	Counts []int
+}
+
+// Delta returns the number of goroutines the stack gained between the
+// first and the last snapshots.
+func (g *Growth) Delta() int {
+	return g.Counts[len(g.Counts)-1] - g.Counts[0]
+}
+
+type growths []*Growth
+
+func (s growths) Len() int      { return len(s) }
+func (s growths) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s growths) Less(i, j int) bool {
+	if di, dj := s[i].Delta(), s[j].Delta(); di != dj {
+		return di > dj
+	}
+	return s[i].key < s[j].key
+}
+
+// Growing returns the stacks whose goroutines grew monotonically over
+// the snapshots, oldest first: their number never decreased from one
+// snapshot to the next, and increased overall. The stacks are sorted by
+// decreasing growth.
+func Growing(snapshots ...Snapshot) []*Growth {
+	if len(snapshots) < 2 {
+		return nil
+	}
+	var l growths
+	for key, g := range snapshots[len(snapshots)-1] {
+		counts := make([]int, len(snapshots))
+		monotonic := true
+		for i, s := range snapshots {
+			if sg, ok := s[key]; ok {
+				counts[i] = sg.Count
+			}
+			if i > 0 && counts[i] < counts[i-1] {
+				monotonic = false
+				break
+			}
+		}
+		if monotonic && counts[len(counts)-1] > counts[0] {
+			l = append(l, &Growth{Group: g, Counts: counts})
+		}
+	}
+	sort.Sort(l)
+	return l
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goroutine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const dump = `goroutine 1 [running]:
+main.main()
+	/app/main.go:20 +0xce
+
+goroutine 7 [chan receive]:
+main.(*T).wait(...)
+	/app/main.go:11
+created by main.main in goroutine 1
+	/app/main.go:16 +0x37
+
+goroutine 8 [chan receive, 2 minutes]:
+main.(*T).wait(...)
+	/app/main.go:11
+created by main.main in goroutine 1
+	/app/main.go:16 +0x37
+
+goroutine 10 [sleep]:
+time.Sleep(0x34630b8a000)
+	/usr/local/go/src/runtime/time.go:368 +0x165
+main.main.func1()
+	/app/main.go:18 +0x1d
+created by main.main
+	/app/main.go:18 +0x9b
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Group{
+		{Stack: []string{"main.(*T).wait"}, CreatedBy: "main.main", Count: 2},
+		{Stack: []string{"main.main"}, Count: 1},
+		{Stack: []string{"time.Sleep", "main.main.func1"}, CreatedBy: "main.main", Count: 1},
+	}
+	if len(s) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(s), len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range s {
+			if reflect.DeepEqual(g.Stack, w.Stack) {
+				found = true
+				if g.CreatedBy != w.CreatedBy || g.Count != w.Count {
+					t.Errorf("%v: got created by %q, count %d; want %q, %d", w.Stack, g.CreatedBy, g.Count, w.CreatedBy, w.Count)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no group for %v", w.Stack)
+		}
+	}
+
+	if _, err := Parse([]byte("not a dump")); err == nil {
+		t.Error("want an error parsing an invalid dump")
+	}
+}
+
+func TestGrowing(t *testing.T) {
+	// snapshot returns a snapshot with n goroutines waiting and m
+	// sleeping.
+	snapshot := func(n, m int) Snapshot {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString("goroutine 7 [chan receive]:\nmain.wait()\n\t/app/main.go:11\ncreated by main.main\n\t/app/main.go:16 +0x37\n\n")
+		}
+		for i := 0; i < m; i++ {
+			b.WriteString("goroutine 8 [sleep]:\nmain.sleep()\n\t/app/main.go:18\ncreated by main.main\n\t/app/main.go:17 +0x37\n\n")
+		}
+		s, err := Parse([]byte(b.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	g := Growing(snapshot(1, 2), snapshot(3, 1), snapshot(3, 4), snapshot(6, 5))
+	if len(g) != 1 {
+		t.Fatalf("got %d growing stacks, want 1", len(g))
+	}
+	if got, want := g[0].Counts, []int{1, 3, 3, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+	if got := g[0].Delta(); got != 5 {
+		t.Errorf("got a delta of %d, want 5", got)
+	}
+
+	if g := Growing(snapshot(2, 2), snapshot(2, 2)); len(g) != 0 {
+		t.Errorf("got %d growing stacks for stable counts, want 0", len(g))
+	}
+}
+
+func TestParseCreators(t *testing.T) {
+	// The goroutines of a handler, created by the goroutines of
+	// different requests.
+	var b strings.Builder
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&b, "goroutine %d [chan receive]:\nmain.wait()\n\t/app/main.go:11\ncreated by main.handle in goroutine %d\n\t/app/main.go:16 +0x37\n\n", 100+i, 10+i)
+	}
+	s, err := Parse([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 1 {
+		t.Fatalf("got %d groups, want 1", len(s))
+	}
+	for _, g := range s {
+		if g.Count != 6 || g.CreatedBy != "main.handle" {
+			t.Errorf("got %d goroutines created by %q, want 6 created by main.handle", g.Count, g.CreatedBy)
+		}
+	}
+}
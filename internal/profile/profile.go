@@ -301,6 +301,7 @@ func (p *Profile) Aggregate(inlineFrame, function, filename, linenumber, address
 			if !function {
 				f.Name = ""
 				f.SystemName = ""
+				f.StartLine = 0
 			}
 			if !filename {
 				f.Filename = ""
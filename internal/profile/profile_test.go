@@ -6,6 +6,8 @@ package profile
 
 import (
 	"bytes"
+	"math"
+	"reflect"
 	"testing"
 )
 
@@ -22,3 +24,49 @@ func TestEmptyProfile(t *testing.T) {
 		t.Errorf("Profile should be empty, got %#v", p)
 	}
 }
+
+func TestPackedRoundTrip(t *testing.T) {
+	want := &Sample{
+		locationIDX: []uint64{1, 300, math.MaxUint64},
+		Value:       []int64{0, -1, 1 << 40, math.MinInt64},
+	}
+
+	// Unpacked, as written by Write.
+	unpacked := marshal(want)
+
+	// Packed, as written by the runtime.
+	var b buffer
+	var data buffer
+	for _, u := range want.locationIDX {
+		encodeVarint(&data, u)
+	}
+	encodeLength(&b, 1, len(data.data))
+	b.data = append(b.data, data.data...)
+	data.data = nil
+	for _, v := range want.Value {
+		encodeVarint(&data, uint64(v))
+	}
+	encodeLength(&b, 2, len(data.data))
+	b.data = append(b.data, data.data...)
+	packed := b.data
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"unpacked", unpacked},
+		{"packed", packed},
+	} {
+		got := &Sample{}
+		if err := unmarshal(tt.data, got); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.locationIDX, want.locationIDX) || !reflect.DeepEqual(got.Value, want.Value) {
+			t.Errorf("%s: got locations %v, values %v, want %v, %v", tt.name, got.locationIDX, got.Value, want.locationIDX, want.Value)
+		}
+	}
+	if bytes.Equal(packed, unpacked) {
+		t.Error("packed and unpacked encodings are the same")
+	}
+}
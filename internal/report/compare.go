@@ -0,0 +1,337 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Comparison compares the nodes of two sets of profiles, e.g. the
+// profiles of several runs of a benchmark before and after a change.
+type Comparison struct {
+	SampleType string
+	Unit       string
+	Alpha      float64 // Significance level.
+	Base, Test int     // Number of profiles of each set.
+	Rows       []ComparisonRow
+
+	rpt *Report // Formats the values.
+}
+
+// ComparisonRow is the comparison of a node across the profiles.
+type ComparisonRow struct {
+	Name string
+
+	// Values of the node in each profile of the sets, and their means.
+	Base, Test         []int64
+	BaseMean, TestMean float64
+
+	// Delta is the relative change of the mean, in percent, and
+	// +Inf for the nodes new to the test profiles.
+	Delta float64
+
+	// P is the p-value of the Mann-Whitney U test of the values: the
+	// probability of a change at least as large as the one observed
+	// if the two sets of values came from the same distribution.
+	P           float64
+	Significant bool // Set if P is below the significance level.
+}
+
+type comparisonRows []ComparisonRow
+
+func (r comparisonRows) Len() int      { return len(r) }
+func (r comparisonRows) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r comparisonRows) Less(i, j int) bool {
+	if r[i].Significant != r[j].Significant {
+		return r[i].Significant
+	}
+	di := math.Abs(r[i].TestMean - r[i].BaseMean)
+	dj := math.Abs(r[j].TestMean - r[j].BaseMean)
+	if di != dj {
+		return di > dj
+	}
+	return r[i].Name < r[j].Name
+}
+
+// Compare compares the flat values of the nodes of the base and the
+// test reports, or their cumulative values with the CumSort option of
+// the first base report. The reports must be built with the same
+// options and value function from compatible profiles. Changes are
+// significant at the significance level alpha. The rows are sorted by
+// significance, then by decreasing absolute change.
+func Compare(base, test []*Report, alpha float64) (*Comparison, error) {
+	if len(base) == 0 || len(test) == 0 {
+		return nil, fmt.Errorf("no profiles to compare")
+	}
+	first := base[0]
+	values := make(map[string]*ComparisonRow)
+	add := func(rpts []*Report, isBase bool) error {
+		for i, rpt := range rpts {
+			if err := first.prof.Compatible(rpt.prof); err != nil {
+				return err
+			}
+			g, err := newGraph(rpt)
+			if err != nil {
+				return err
+			}
+			for _, n := range g.ns {
+				name := n.info.prettyName()
+				r, ok := values[name]
+				if !ok {
+					r = &ComparisonRow{Name: name, Base: make([]int64, len(base)), Test: make([]int64, len(test))}
+					values[name] = r
+				}
+				v := n.flat
+				if first.options.CumSort {
+					v = n.cum
+				}
+				if isBase {
+					r.Base[i] += v
+				} else {
+					r.Test[i] += v
+				}
+			}
+		}
+		return nil
+	}
+	if err := add(base, true); err != nil {
+		return nil, err
+	}
+	if err := add(test, false); err != nil {
+		return nil, err
+	}
+
+	c := &Comparison{
+		SampleType: first.options.SampleType,
+		Unit:       first.options.SampleUnit,
+		Alpha:      alpha,
+		Base:       len(base),
+		Test:       len(test),
+		rpt:        first,
+	}
+	for _, r := range values {
+		r.BaseMean, r.TestMean = mean(r.Base), mean(r.Test)
+		if r.BaseMean == 0 && r.TestMean == 0 {
+			continue
+		}
+		switch {
+		case r.BaseMean != 0:
+			r.Delta = (r.TestMean - r.BaseMean) / math.Abs(r.BaseMean) * 100
+		default:
+			r.Delta = math.Inf(1)
+		}
+		r.P = mannWhitney(r.Base, r.Test)
+		r.Significant = r.P < alpha
+		c.Rows = append(c.Rows, *r)
+	}
+	sort.Sort(comparisonRows(c.Rows))
+	return c, nil
+}
+
+// WriteText writes the comparison as a table, one row per node, with
+// the mean and the coefficient of variation of each set. Significant
+// changes are marked with a *.
+func (c *Comparison) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%s: %d base and %d test profiles, changes significant at p < %g marked with *\n",
+		c.SampleType, c.Base, c.Test, c.Alpha)
+	fmt.Fprintf(w, "%18s %18s %9s %8s %10s   %s\n", "base", "test", "delta", "p-value", "confidence", "name")
+	for _, r := range c.Rows {
+		mark := " "
+		if r.Significant {
+			mark = "*"
+		}
+		delta := "new"
+		if !math.IsInf(r.Delta, 0) {
+			delta = fmt.Sprintf("%+.1f%%", r.Delta)
+		}
+		fmt.Fprintf(w, "%18s %18s %9s %8.3f %9.1f%% %s %s\n",
+			c.formatMean(r.BaseMean, r.Base), c.formatMean(r.TestMean, r.Test),
+			delta, r.P, (1-r.P)*100, mark, r.Name)
+	}
+	return nil
+}
+
+// formatMean formats the mean of values and their coefficient of
+// variation.
+func (c *Comparison) formatMean(m float64, values []int64) string {
+	s := c.rpt.formatValue(int64(m))
+	if m != 0 && len(values) > 1 {
+		s += fmt.Sprintf(" ± %2.0f%%", stddev(values, m)/math.Abs(m)*100)
+	}
+	return s
+}
+
+// WriteJSON writes the comparison as JSON.
+func (c *Comparison) WriteJSON(w io.Writer) error {
+	type row struct {
+		Name        string   `json:"name"`
+		Base        []int64  `json:"base"`
+		Test        []int64  `json:"test"`
+		BaseMean    float64  `json:"base_mean"`
+		TestMean    float64  `json:"test_mean"`
+		Delta       *float64 `json:"delta_percent"` // null for new nodes
+		P           float64  `json:"p_value"`
+		Confidence  float64  `json:"confidence"`
+		Significant bool     `json:"significant"`
+	}
+	out := struct {
+		SampleType string  `json:"sample_type"`
+		Unit       string  `json:"unit"`
+		Alpha      float64 `json:"alpha"`
+		Rows       []row   `json:"rows"`
+	}{c.SampleType, c.Unit, c.Alpha, []row{}}
+	for _, r := range c.Rows {
+		var delta *float64
+		if !math.IsInf(r.Delta, 0) {
+			d := r.Delta
+			delta = &d
+		}
+		out.Rows = append(out.Rows, row{r.Name, r.Base, r.Test, r.BaseMean, r.TestMean, delta, r.P, 1 - r.P, r.Significant})
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func mean(values []int64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	return sum / float64(len(values))
+}
+
+func stddev(values []int64, m float64) float64 {
+	var sum float64
+	for _, v := range values {
+		d := float64(v) - m
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// A sampleValue is a value of one of the samples of a statistical
+// test.
+type sampleValue struct {
+	v   int64
+	inX bool
+}
+
+type sampleValues []sampleValue
+
+func (s sampleValues) Len() int           { return len(s) }
+func (s sampleValues) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sampleValues) Less(i, j int) bool { return s[i].v < s[j].v }
+
+// maxExact is the largest total number of values for which the exact
+// distribution of the U statistic is computed.
+const maxExact = 50
+
+// mannWhitney returns the two-sided p-value of the Mann-Whitney U test
+// of the values x and y. The p-value is exact for small samples with no
+// ties, and uses the normal approximation with a tie correction
+// otherwise.
+func mannWhitney(x, y []int64) float64 {
+	n1, n2 := len(x), len(y)
+	all := make(sampleValues, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, sampleValue{v, true})
+	}
+	for _, v := range y {
+		all = append(all, sampleValue{v, false})
+	}
+	sort.Sort(all)
+
+	// Rank the values, averaging the ranks of ties.
+	var rx, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].inX {
+				rx += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties += t*t*t - t
+		}
+		i = j
+	}
+	u := rx - float64(n1*(n1+1))/2
+	if u > float64(n1*n2)/2 {
+		u = float64(n1*n2) - u
+	}
+
+	n := float64(n1 + n2)
+	if ties == 0 && n1+n2 <= maxExact {
+		return math.Min(1, 2*uCDF(n1, n2, int(u)))
+	}
+	sigma := math.Sqrt(float64(n1*n2) / 12 * (n + 1 - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (float64(n1*n2)/2 - u - 0.5) / sigma
+	if z < 0 {
+		return 1
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// uCDF returns the probability that the U statistic of samples of
+// sizes n1 and n2 with no ties is at most u, under the hypothesis that
+// they come from the same distribution.
+func uCDF(n1, n2, u int) float64 {
+	// counts[i][j][k] is the number of orderings of i values of x and
+	// j values of y in which k pairs have the value of x larger. The
+	// largest value is either from x, larger than the j values of y,
+	// or from y.
+	counts := make([][][]float64, n1+1)
+	for i := range counts {
+		counts[i] = make([][]float64, n2+1)
+		for j := range counts[i] {
+			counts[i][j] = make([]float64, i*j+1)
+			if i == 0 || j == 0 {
+				counts[i][j][0] = 1
+				continue
+			}
+			for k := range counts[i][j] {
+				if k >= j && k-j < len(counts[i-1][j]) {
+					counts[i][j][k] += counts[i-1][j][k-j]
+				}
+				if k < len(counts[i][j-1]) {
+					counts[i][j][k] += counts[i][j-1][k]
+				}
+			}
+		}
+	}
+	var below, total float64
+	for k, c := range counts[n1][n2] {
+		if k <= u {
+			below += c
+		}
+		total += c
+	}
+	return below / total
+}
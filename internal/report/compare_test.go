@@ -0,0 +1,166 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/rakyll/gom/internal/profile"
+)
+
+func TestMannWhitney(t *testing.T) {
+	for _, tt := range []struct {
+		x, y []int64
+		want float64
+	}{
+		// Exact, no overlap: 2 orderings out of 252 are as extreme.
+		{[]int64{1, 2, 3, 4, 5}, []int64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{[]int64{6, 7, 8, 9, 10}, []int64{1, 2, 3, 4, 5}, 2.0 / 252},
+		// Exact, interleaved.
+		{[]int64{1, 3, 5, 7, 9}, []int64{2, 4, 6, 8, 10}, 0.690476},
+		// Identical values.
+		{[]int64{5, 5, 5}, []int64{5, 5, 5}, 1},
+		// Normal approximation with ties.
+		{[]int64{1, 1, 2, 2, 3}, []int64{3, 4, 4, 5, 5}, 0.014707},
+	} {
+		if got := mannWhitney(tt.x, tt.y); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("mannWhitney(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+// compareReport returns the report of a CPU profile in which main.main
+// calls main.a and main.b, and main.c runs on its own, for the given
+// number of nanoseconds.
+func compareReport(a, b, c int64, cum bool) *Report {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+	}
+	locs := make(map[string]*profile.Location)
+	for i, name := range []string{"main.main", "main.a", "main.b", "main.c"} {
+		f := &profile.Function{ID: uint64(i + 1), Name: name, SystemName: name}
+		l := &profile.Location{ID: uint64(i + 1), Line: []profile.Line{{Function: f}}}
+		p.Function = append(p.Function, f)
+		p.Location = append(p.Location, l)
+		locs[name] = l
+	}
+	for _, s := range []struct {
+		v     int64
+		stack []string
+	}{
+		{a, []string{"main.a", "main.main"}},
+		{b, []string{"main.b", "main.main"}},
+		{c, []string{"main.c"}},
+	} {
+		if s.v == 0 {
+			continue
+		}
+		sample := &profile.Sample{Value: []int64{s.v}}
+		for _, name := range s.stack {
+			sample.Location = append(sample.Location, locs[name])
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	value := func(s *profile.Sample) int64 { return s.Value[0] }
+	return New(p, Options{SampleType: "cpu", CumSort: cum}, value, "nanoseconds")
+}
+
+func TestCompare(t *testing.T) {
+	var base, test, baseCum, testCum []*Report
+	for i := int64(0); i < 5; i++ {
+		// main.a gets slower, main.b goes away and main.c is new.
+		base = append(base, compareReport(10+i, 20, 0, false))
+		test = append(test, compareReport(30+i, 0, 5, false))
+		baseCum = append(baseCum, compareReport(10+i, 20, 0, true))
+		testCum = append(testCum, compareReport(30+i, 0, 5, true))
+	}
+
+	c, err := Compare(base, test, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Base != 5 || c.Test != 5 || c.SampleType != "cpu" {
+		t.Errorf("got %d base and %d test %s profiles, want 5 and 5 cpu", c.Base, c.Test, c.SampleType)
+	}
+	rows := make(map[string]ComparisonRow)
+	for _, r := range c.Rows {
+		rows[r.Name] = r
+	}
+	if _, ok := rows["main.main"]; ok {
+		t.Errorf("got a row for main.main, with no flat value")
+	}
+	for _, tt := range []struct {
+		name               string
+		baseMean, testMean float64
+		delta              float64
+		significant        bool
+	}{
+		{"main.a", 12, 32, 20.0 / 12 * 100, true},
+		{"main.b", 20, 0, -100, true},
+		{"main.c", 0, 5, math.Inf(1), true},
+	} {
+		r, ok := rows[tt.name]
+		if !ok {
+			t.Errorf("no row for %s", tt.name)
+			continue
+		}
+		if r.BaseMean != tt.baseMean || r.TestMean != tt.testMean {
+			t.Errorf("%s: got means %v and %v, want %v and %v", tt.name, r.BaseMean, r.TestMean, tt.baseMean, tt.testMean)
+		}
+		if math.Abs(r.Delta-tt.delta) > 1e-9 && !(math.IsInf(tt.delta, 1) && math.IsInf(r.Delta, 1)) {
+			t.Errorf("%s: got a delta of %v%%, want %v%%", tt.name, r.Delta, tt.delta)
+		}
+		if r.Significant != tt.significant {
+			t.Errorf("%s: got significant %v (p = %v), want %v", tt.name, r.Significant, r.P, tt.significant)
+		}
+	}
+	// The largest change first.
+	if c.Rows[0].Name != "main.a" {
+		t.Errorf("got %s first, want main.a", c.Rows[0].Name)
+	}
+
+	// With CumSort, main.main is compared and does not change.
+	c, err = Compare(baseCum, testCum, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, r := range c.Rows {
+		if r.Name != "main.main" {
+			continue
+		}
+		found = true
+		if r.BaseMean != 32 || r.TestMean != 32 || r.Delta != 0 || r.Significant {
+			t.Errorf("main.main: got means %v and %v, a delta of %v%% and significant %v, want 32, 32, 0%% and false",
+				r.BaseMean, r.TestMean, r.Delta, r.Significant)
+		}
+	}
+	if !found {
+		t.Errorf("no row for main.main with CumSort")
+	}
+
+	// Incompatible profiles.
+	other := compareReport(1, 1, 1, false)
+	other.prof.SampleType[0] = &profile.ValueType{Type: "alloc_space", Unit: "bytes"}
+	if _, err := Compare(base, []*Report{other}, 0.05); err == nil || !strings.Contains(err.Error(), "incompatible") {
+		t.Errorf("got error %v comparing incompatible profiles, want incompatible sample types", err)
+	}
+	if _, err := Compare(nil, test, 0.05); err == nil {
+		t.Errorf("got no error comparing no profiles")
+	}
+}
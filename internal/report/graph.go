@@ -0,0 +1,144 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package report
+
+// This file exports the call graph and the top list of reports to user
+// interfaces, so they can sort, select and format their entries.
+
+// Graph is the call graph of a report.
+type Graph struct {
+	// Nodes are sorted by decreasing flat value, or by decreasing
+	// cum value if the report is sorted by cum.
+	Nodes []*Node
+}
+
+// Node is a function, a file, a line or an address of a call graph,
+// depending on the granularity of the profile.
+type Node struct {
+	Name      string // Printable name, as in text reports.
+	Function  string
+	File      string
+	Line      int
+	Address   uint64
+	Inline    bool
+	Flat, Cum int64
+
+	In, Out []*Edge // Callers and callees, by decreasing weight.
+}
+
+// Edge is a call from a node to another.
+type Edge struct {
+	From, To *Node
+	Weight   int64
+	Residual bool // Set if the call goes through removed nodes.
+}
+
+// NewGraph builds the call graph of a report. Nodes and edges are
+// dropped as directed by the NodeCount, NodeFraction and EdgeFraction
+// options.
+func NewGraph(rpt *Report) (*Graph, error) {
+	g, err := newGraph(rpt)
+	if err != nil {
+		return nil, err
+	}
+	g.preprocess(rpt)
+
+	nodes := make(map[*node]*Node, len(g.ns))
+	out := &Graph{}
+	for _, n := range g.ns {
+		nn := &Node{
+			Name:     n.info.prettyName(),
+			Function: n.info.name,
+			File:     n.info.file,
+			Line:     n.info.lineno,
+			Address:  n.info.address,
+			Inline:   n.info.inline,
+			Flat:     n.flat,
+			Cum:      n.cum,
+		}
+		nodes[n] = nn
+		out.Nodes = append(out.Nodes, nn)
+	}
+	edges := make(map[*edgeInfo]*Edge)
+	edge := func(e *edgeInfo) *Edge {
+		if ee, ok := edges[e]; ok {
+			return ee
+		}
+		ee := &Edge{
+			From:     nodes[e.src],
+			To:       nodes[e.dest],
+			Weight:   e.weight,
+			Residual: e.residual,
+		}
+		edges[e] = ee
+		return ee
+	}
+	for _, n := range g.ns {
+		nn := nodes[n]
+		for _, e := range sortedEdges(n.in) {
+			if nodes[e.src] != nil {
+				nn.In = append(nn.In, edge(e))
+			}
+		}
+		for _, e := range sortedEdges(n.out) {
+			if nodes[e.dest] != nil {
+				nn.Out = append(nn.Out, edge(e))
+			}
+		}
+	}
+	return out, nil
+}
+
+// Table is the top list of a report, as printed by text reports.
+type Table struct {
+	SampleType string
+	Unit       string // Unit of the values, before formatting.
+	Total      int64
+	Rows       []Row
+}
+
+// Row is an entry of the top list.
+type Row struct {
+	*Node
+
+	FlatSum int64 // Sum of the flat values of the rows up to this one.
+
+	// Percentages of the total.
+	FlatPercent, FlatSumPercent, CumPercent float64
+}
+
+// NewTable builds the top list of a report. Rows are in the order of
+// the nodes of its call graph.
+func NewTable(rpt *Report) (*Table, error) {
+	g, err := NewGraph(rpt)
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{
+		SampleType: rpt.options.SampleType,
+		Unit:       rpt.options.SampleUnit,
+		Total:      rpt.total,
+		Rows:       make([]Row, len(g.Nodes)),
+	}
+	var flatSum int64
+	for i, n := range g.Nodes {
+		flatSum += n.Flat
+		t.Rows[i] = Row{
+			Node:           n,
+			FlatSum:        flatSum,
+			FlatPercent:    ratio(n.Flat, rpt.total),
+			FlatSumPercent: ratio(flatSum, rpt.total),
+			CumPercent:     ratio(n.Cum, rpt.total),
+		}
+	}
+	return t, nil
+}
+
+func ratio(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total) * 100
+}
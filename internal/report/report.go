@@ -57,39 +57,45 @@ func Generate(w io.Writer, rpt *Report, obj plugin.ObjTool) error {
 
 type reportEl struct {
 	Name           string  `json:"name"`
+	Function       string  `json:"function,omitempty"`
+	File           string  `json:"file,omitempty"`
+	Line           int     `json:"line,omitempty"`
 	Flat           string  `json:"flat"`
 	FlatPercent    string  `json:"flat_perc"`
 	FlatSumPercent string  `json:"flatsum_perc"`
 	Cum            string  `json:"cum"`
 	CumPercent     string  `json:"cum_perc"`
+	FlatValue      int64   `json:"flat_value"`
+	CumValue       int64   `json:"cum_value"`
+	Unit           string  `json:"unit"`
 	Score          float64 `json:"score"`
 }
 
 func printJSON(w io.Writer, rpt *Report) error {
-	g, err := newGraph(rpt)
+	t, err := NewTable(rpt)
 	if err != nil {
 		return err
 	}
-	g.preprocess(rpt)
-	var flatSum int64
-	var l = make([]*reportEl, len(g.ns))
-	for i, n := range g.ns {
-		name, flat, cum := n.info.prettyName(), n.flat, n.cum
-		flatSum += flat
+	var l = make([]*reportEl, len(t.Rows))
+	for i, r := range t.Rows {
 		l[i] = &reportEl{
-			Name:           name,
-			Flat:           rpt.formatValue(flat),
-			FlatPercent:    percentage(flat, rpt.total),
-			FlatSumPercent: percentage(flatSum, rpt.total),
-			Cum:            rpt.formatValue(cum),
-			CumPercent:     percentage(cum, rpt.total),
-		}
-		if rpt.total > 0 {
-			if rpt.options.CumSort {
-				l[i].Score = float64(cum) / float64(rpt.total)
-			} else {
-				l[i].Score = float64(flat) / float64(rpt.total)
-			}
+			Name:           r.Name,
+			Function:       r.Function,
+			File:           r.File,
+			Line:           r.Line,
+			Flat:           rpt.formatValue(r.Flat),
+			FlatPercent:    percentage(r.Flat, t.Total),
+			FlatSumPercent: percentage(r.FlatSum, t.Total),
+			Cum:            rpt.formatValue(r.Cum),
+			CumPercent:     percentage(r.Cum, t.Total),
+			FlatValue:      r.Flat,
+			CumValue:       r.Cum,
+			Unit:           t.Unit,
+		}
+		if rpt.options.CumSort {
+			l[i].Score = r.CumPercent / 100
+		} else {
+			l[i].Score = r.FlatPercent / 100
 		}
 	}
 	return json.NewEncoder(w).Encode(l)
@@ -362,6 +368,74 @@ func printTags(w io.Writer, rpt *Report) error {
 	return nil
 }
 
+// LabelValue is the total value of the samples of a report carrying a
+// value of a label.
+type LabelValue struct {
+	Value  string // Label value, empty for the samples without the label.
+	Weight int64
+}
+
+// LabelBreakdown breaks down the samples of a report by the values of
+// the label key. Numeric label values are formatted with their unit.
+// Samples with several values for the label are counted for each of
+// them. The values are sorted by decreasing weight.
+func LabelBreakdown(rpt *Report, key string) []LabelValue {
+	weights := make(map[string]int64)
+	for _, s := range rpt.prof.Sample {
+		v := rpt.sampleValue(s)
+		vals := append([]string(nil), s.Label[key]...)
+		for _, nval := range s.NumLabel[key] {
+			vals = append(vals, scaledValueLabel(nval, key, "auto"))
+		}
+		if len(vals) == 0 {
+			weights[""] += v
+		}
+		for _, val := range vals {
+			weights[val] += v
+		}
+	}
+	lvs := make(labelValues, 0, len(weights))
+	for val, w := range weights {
+		lvs = append(lvs, LabelValue{val, w})
+	}
+	sort.Sort(lvs)
+	return lvs
+}
+
+type labelValues []LabelValue
+
+func (l labelValues) Len() int      { return len(l) }
+func (l labelValues) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l labelValues) Less(i, j int) bool {
+	if l[i].Weight != l[j].Weight {
+		return l[i].Weight > l[j].Weight
+	}
+	return l[i].Value < l[j].Value
+}
+
+// LabelKeys returns the sorted keys of the labels of the samples of a
+// profile.
+func LabelKeys(prof *profile.Profile) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, s := range prof.Sample {
+		for key := range s.Label {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		for key := range s.NumLabel {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // printText prints a flat text report for a profile.
 func printText(w io.Writer, rpt *Report) error {
 	g, err := newGraph(rpt)
@@ -1002,6 +1076,8 @@ type Options struct {
 	OutputUnit string // Units for data formatting in report.
 
 	Symbol *regexp.Regexp // Symbols to include on disassembly report.
+
+	SourcePath []PathRule // Rules to locate source files for source listing reports.
 }
 
 // newGraph summarizes performance data from a profile into a graph.
@@ -1742,6 +1818,16 @@ type Report struct {
 	formatValue func(int64) string
 }
 
+// Total returns the total value of the samples in the report.
+func (rpt *Report) Total() int64 {
+	return rpt.total
+}
+
+// FormatValue formats a sample value in the output unit of the report.
+func (rpt *Report) FormatValue(v int64) string {
+	return rpt.formatValue(v)
+}
+
 func (rpt *Report) formatTags(s *profile.Sample) (string, bool) {
 	var labels []string
 	for key, vals := range s.Label {
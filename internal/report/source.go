@@ -12,7 +12,6 @@ import (
 	"fmt"
 	"html/template"
 	"io"
-	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -21,15 +20,33 @@ import (
 	"github.com/rakyll/gom/internal/plugin"
 )
 
-// printSource prints an annotated source listing, include all
-// functions with samples that match the regexp rpt.options.symbol.
-// The sources are sorted by function name and then by filename to
-// eliminate potential nondeterminism.
-func printSource(w io.Writer, rpt *Report) error {
+// FunctionSource is the annotated source of a function in a source
+// file.
+type FunctionSource struct {
+	Name      string       // Function name.
+	File      string       // Path of the source file, after adjustments.
+	Flat, Cum int64        // Values of the function in this file.
+	Lines     []SourceLine // Annotated source lines.
+	Err       error        // Set if the source could not be read.
+}
+
+// SourceLine is a source line annotated with the samples attributed
+// to it.
+type SourceLine struct {
+	Line      int
+	Text      string
+	Flat, Cum int64
+}
+
+// Source collects the annotated sources of all the functions with
+// samples that match the regexp rpt.options.Symbol. The sources are
+// sorted by function name and then by filename to eliminate potential
+// nondeterminism.
+func Source(rpt *Report) ([]*FunctionSource, error) {
 	o := rpt.options
 	g, err := newGraph(rpt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Identify all the functions that match the regexp provided.
@@ -47,7 +64,7 @@ func printSource(w io.Writer, rpt *Report) error {
 	}
 	functions.sort(nameOrder)
 
-	fmt.Fprintf(w, "Total: %s\n", rpt.formatValue(rpt.total))
+	var srcs []*FunctionSource
 	for _, fn := range functions {
 		name := fn.info.name
 
@@ -66,32 +83,71 @@ func printSource(w io.Writer, rpt *Report) error {
 		}
 
 		if len(sourceFiles) == 0 {
-			fmt.Printf("No source information for %s\n", name)
+			srcs = append(srcs, &FunctionSource{
+				Name: name,
+				Err:  errNoSourceInfo,
+			})
 			continue
 		}
 
 		sourceFiles.sort(fileOrder)
 
-		// Print each file associated with this function.
+		// Collect each file associated with this function.
 		for _, fl := range sourceFiles {
 			filename := fl.info.file
 			fns := fileNodes[filename]
 			flatSum, cumSum := sumNodes(fns)
 
-			fnodes, path, err := getFunctionSource(name, filename, fns, 0, 0)
-			fmt.Fprintf(w, "ROUTINE ======================== %s in %s\n", name, path)
-			fmt.Fprintf(w, "%10s %10s (flat, cum) %s of Total\n",
-				rpt.formatValue(flatSum), rpt.formatValue(cumSum),
-				percentage(cumSum, rpt.total))
-
-			if err != nil {
-				fmt.Fprintf(w, " Error: %v\n", err)
-				continue
+			fnodes, path, err := getFunctionSource(name, filename, fns, 0, 0, o)
+			src := &FunctionSource{
+				Name: name,
+				File: path,
+				Flat: flatSum,
+				Cum:  cumSum,
+				Err:  err,
 			}
-
 			for _, fn := range fnodes {
-				fmt.Fprintf(w, "%10s %10s %6d:%s\n", valueOrDot(fn.flat, rpt), valueOrDot(fn.cum, rpt), fn.info.lineno, fn.info.name)
+				src.Lines = append(src.Lines, SourceLine{
+					Line: fn.info.lineno,
+					Text: fn.info.name,
+					Flat: fn.flat,
+					Cum:  fn.cum,
+				})
 			}
+			srcs = append(srcs, src)
+		}
+	}
+	return srcs, nil
+}
+
+var errNoSourceInfo = fmt.Errorf("no source information")
+
+// printSource prints an annotated source listing, include all
+// functions with samples that match the regexp rpt.options.symbol.
+func printSource(w io.Writer, rpt *Report) error {
+	srcs, err := Source(rpt)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Total: %s\n", rpt.formatValue(rpt.total))
+	for _, src := range srcs {
+		if src.Err == errNoSourceInfo {
+			fmt.Fprintf(w, "No source information for %s\n", src.Name)
+			continue
+		}
+		fmt.Fprintf(w, "ROUTINE ======================== %s in %s\n", src.Name, src.File)
+		fmt.Fprintf(w, "%10s %10s (flat, cum) %s of Total\n",
+			rpt.formatValue(src.Flat), rpt.formatValue(src.Cum),
+			percentage(src.Cum, rpt.total))
+
+		if src.Err != nil {
+			fmt.Fprintf(w, " Error: %v\n", src.Err)
+			continue
+		}
+
+		for _, l := range src.Lines {
+			fmt.Fprintf(w, "%10s %10s %6d:%s\n", valueOrDot(l.Flat, rpt), valueOrDot(l.Cum, rpt), l.Line, l.Text)
 		}
 	}
 	return nil
@@ -126,6 +182,13 @@ func printWebSource(w io.Writer, rpt *Report, obj plugin.ObjTool) error {
 	sort.Sort(syms)
 
 	if len(syms) == 0 {
+		// The binaries may not be available locally, e.g. when the
+		// profile was fetched from another machine. Fall back to a
+		// listing without assembly.
+		if srcs, err := Source(rpt); err == nil && len(srcs) > 0 {
+			printWebSourceOnly(w, srcs, rpt)
+			return nil
+		}
 		return fmt.Errorf("no samples found on routines matching: %s", o.Symbol.String())
 	}
 
@@ -161,9 +224,9 @@ func printWebSource(w io.Writer, rpt *Report, obj plugin.ObjTool) error {
 			asm := assemblyPerSourceLine(symbols, fns, filename, obj)
 			start, end := sourceCoordinates(asm)
 
-			fnodes, path, err := getFunctionSource(name, filename, fns, start, end)
+			fnodes, path, err := getFunctionSource(name, filename, fns, start, end, o)
 			if err != nil {
-				fnodes, path = getMissingFunctionSource(filename, asm, start, end)
+				fnodes, path = getMissingFunctionSource(filename, asm, start, end, o)
 			}
 
 			flatSum, cumSum := sumNodes(fnodes)
@@ -178,6 +241,27 @@ func printWebSource(w io.Writer, rpt *Report, obj plugin.ObjTool) error {
 	return nil
 }
 
+// printWebSourceOnly prints an annotated source listing of srcs with
+// no assembly.
+func printWebSourceOnly(w io.Writer, srcs []*FunctionSource, rpt *Report) {
+	printHeader(w, rpt)
+	for _, src := range srcs {
+		if src.Err != nil {
+			fmt.Fprintf(w, "<h1>%s</h1>%s\n<pre>  Error: %s</pre>\n",
+				template.HTMLEscapeString(src.Name), template.HTMLEscapeString(src.File),
+				template.HTMLEscapeString(src.Err.Error()))
+			continue
+		}
+		printFunctionHeader(w, src.Name, src.File, src.Flat, src.Cum, rpt)
+		for _, l := range src.Lines {
+			fn := &node{info: nodeInfo{name: l.Text, lineno: l.Line}, flat: l.Flat, cum: l.Cum}
+			printFunctionSourceLine(w, fn, nil, rpt)
+		}
+		printFunctionClosing(w)
+	}
+	printPageClosing(w)
+}
+
 // sourceCoordinates returns the lowest and highest line numbers from
 // a set of assembly statements.
 func sourceCoordinates(asm map[int]nodes) (start, end int) {
@@ -314,8 +398,8 @@ func printPageClosing(w io.Writer) {
 // getFunctionSource collects the sources of a function from a source
 // file and annotates it with the samples in fns. Returns the sources
 // as nodes, using the info.name field to hold the source code.
-func getFunctionSource(fun, file string, fns nodes, start, end int) (nodes, string, error) {
-	f, file, err := adjustSourcePath(file)
+func getFunctionSource(fun, file string, fns nodes, start, end int, o *Options) (nodes, string, error) {
+	f, file, err := adjustSourcePath(file, o.SourcePath)
 	if err != nil {
 		return nil, file, err
 	}
@@ -388,7 +472,7 @@ func getFunctionSource(fun, file string, fns nodes, start, end int) (nodes, stri
 
 // getMissingFunctionSource creates a dummy function body to point to
 // the source file and annotates it with the samples in asm.
-func getMissingFunctionSource(filename string, asm map[int]nodes, start, end int) (nodes, string) {
+func getMissingFunctionSource(filename string, asm map[int]nodes, start, end int, o *Options) (nodes, string) {
 	var fnodes nodes
 	for i := start; i <= end; i++ {
 		lrs := asm[i]
@@ -405,50 +489,5 @@ func getMissingFunctionSource(filename string, asm map[int]nodes, start, end int
 			cum:  cum,
 		})
 	}
-	return fnodes, filename
-}
-
-// adjustSourcePath adjusts the pathe for a source file by trimmming
-// known prefixes and searching for the file on all parents of the
-// current working dir.
-func adjustSourcePath(path string) (*os.File, string, error) {
-	path = trimPath(path)
-	f, err := os.Open(path)
-	if err == nil {
-		return f, path, nil
-	}
-
-	if dir, wderr := os.Getwd(); wderr == nil {
-		for {
-			parent := filepath.Dir(dir)
-			if parent == dir {
-				break
-			}
-			if f, err := os.Open(filepath.Join(parent, path)); err == nil {
-				return f, filepath.Join(parent, path), nil
-			}
-
-			dir = parent
-		}
-	}
-
-	return nil, path, err
-}
-
-// trimPath cleans up a path by removing prefixes that are commonly
-// found on profiles.
-func trimPath(path string) string {
-	basePaths := []string{
-		"/proc/self/cwd/./",
-		"/proc/self/cwd/",
-	}
-
-	sPath := filepath.ToSlash(path)
-
-	for _, base := range basePaths {
-		if strings.HasPrefix(sPath, base) {
-			return filepath.FromSlash(sPath[len(base):])
-		}
-	}
-	return path
+	return fnodes, sourcePath(filename, o.SourcePath)
 }
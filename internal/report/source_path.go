@@ -0,0 +1,389 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package report
+
+// This file contains routines to locate the source files recorded in
+// profiles on the local file system.
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// A PathRule maps the path of a source file recorded in a profile to
+// candidate paths on the local file system.
+type PathRule func(path string) []string
+
+// PrefixRule returns a rule replacing the prefix from of source paths
+// with to.
+func PrefixRule(from, to string) PathRule {
+	return func(p string) []string {
+		if !strings.HasPrefix(p, from) {
+			return nil
+		}
+		return []string{to + p[len(from):]}
+	}
+}
+
+// ModuleRule returns a rule resolving the source paths of the main
+// module and of its dependencies, as recorded by builds in containers,
+// with -trimpath or in GOPATH mode. Sources of the main module are
+// found next to the go.mod file at gomod. Sources of dependencies are
+// found in the module cache, at the versions required by gomod.
+func ModuleRule(gomod string) (PathRule, error) {
+	mf, err := parseGoMod(gomod)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(gomod)
+	modcache := moduleCache()
+	return func(p string) []string {
+		p = filepath.ToSlash(p)
+		var candidates []string
+		for _, ip := range importPaths(p) {
+			if rest, ok := trimModulePath(ip, mf.module); ok {
+				candidates = append(candidates, filepath.Join(dir, filepath.FromSlash(rest)))
+				continue
+			}
+			var mod string
+			for m := range mf.require {
+				if _, ok := trimModulePath(ip, m); ok && len(m) > len(mod) {
+					mod = m
+				}
+			}
+			if mod == "" {
+				continue
+			}
+			rest, _ := trimModulePath(ip, mod)
+			if r, ok := mf.replace[mod]; ok {
+				if r.version == "" {
+					rdir := filepath.FromSlash(r.path)
+					if !filepath.IsAbs(rdir) {
+						rdir = filepath.Join(dir, rdir)
+					}
+					candidates = append(candidates, filepath.Join(rdir, filepath.FromSlash(rest)))
+					continue
+				}
+				candidates = append(candidates, moduleFile(modcache, r.path, r.version, rest))
+				continue
+			}
+			candidates = append(candidates, moduleFile(modcache, mod, mf.require[mod], rest))
+		}
+		return candidates
+	}, nil
+}
+
+// VendorRule returns a rule resolving the source paths of packages to
+// the vendor directory dir.
+func VendorRule(dir string) PathRule {
+	return func(p string) []string {
+		var candidates []string
+		for _, ip := range importPaths(filepath.ToSlash(p)) {
+			candidates = append(candidates, filepath.Join(dir, filepath.FromSlash(ip)))
+		}
+		return candidates
+	}
+}
+
+// ParsePathRules parses a comma-separated list of path rules. Rules
+// can be of the form from=to to replace path prefixes,
+// gomod:path/to/go.mod to resolve module sources or
+// vendor:path/to/vendor to resolve vendored sources.
+func ParsePathRules(s string) ([]PathRule, error) {
+	var rules []PathRule
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(r, "gomod:"):
+			rule, err := ModuleRule(strings.TrimPrefix(r, "gomod:"))
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		case strings.HasPrefix(r, "vendor:"):
+			rules = append(rules, VendorRule(strings.TrimPrefix(r, "vendor:")))
+		case strings.Contains(r, "="):
+			p := strings.SplitN(r, "=", 2)
+			rules = append(rules, PrefixRule(p[0], p[1]))
+		default:
+			return nil, fmt.Errorf("unrecognized source path rule: %s", r)
+		}
+	}
+	return rules, nil
+}
+
+// adjustSourcePath adjusts the pathe for a source file by trimmming
+// known prefixes, applying the rules and searching for the file on all
+// parents of the current working dir and on the Go source roots.
+func adjustSourcePath(p string, rules []PathRule) (*os.File, string, error) {
+	p = trimPath(p)
+	for _, rule := range rules {
+		for _, c := range rule(p) {
+			if f, err := os.Open(c); err == nil {
+				return f, c, nil
+			}
+		}
+	}
+
+	f, err := os.Open(p)
+	if err == nil {
+		return f, p, nil
+	}
+
+	if dir, wderr := os.Getwd(); wderr == nil {
+		for {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			if f, err := os.Open(filepath.Join(parent, p)); err == nil {
+				return f, filepath.Join(parent, p), nil
+			}
+
+			dir = parent
+		}
+	}
+
+	// Binaries built elsewhere record the GOROOT, GOPATH and module
+	// cache of the build machine. Look for successively shorter
+	// suffixes of the path under the local equivalents.
+	parts := strings.Split(filepath.ToSlash(p), "/")
+	for _, root := range goSourceRoots() {
+		for i := 0; i < len(parts)-1; i++ {
+			c := filepath.Join(root, filepath.FromSlash(strings.Join(parts[i:], "/")))
+			if f, err := os.Open(c); err == nil {
+				return f, c, nil
+			}
+		}
+	}
+
+	return nil, p, err
+}
+
+// sourcePath returns the local path of a source file, or its trimmed
+// path if it cannot be found.
+func sourcePath(p string, rules []PathRule) string {
+	f, p, err := adjustSourcePath(p, rules)
+	if err == nil {
+		f.Close()
+	}
+	return p
+}
+
+var bazelPathRx = regexp.MustCompile(`^.*/(sandbox/[^/]+/[^/]+/)?execroot/[^/]+/`)
+
+// trimPath cleans up a path by removing prefixes that are commonly
+// found on profiles.
+func trimPath(path string) string {
+	basePaths := []string{
+		"/proc/self/cwd/./",
+		"/proc/self/cwd/",
+	}
+
+	sPath := filepath.ToSlash(path)
+
+	for _, base := range basePaths {
+		if strings.HasPrefix(sPath, base) {
+			return filepath.FromSlash(sPath[len(base):])
+		}
+	}
+	if loc := bazelPathRx.FindStringIndex(sPath); loc != nil {
+		return filepath.FromSlash(sPath[loc[1]:])
+	}
+	return path
+}
+
+// goSourceRoots returns the local directories holding Go sources: the
+// GOROOT sources, the module cache and the GOPATH source trees.
+func goSourceRoots() []string {
+	roots := []string{filepath.Join(build.Default.GOROOT, "src"), moduleCache()}
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		roots = append(roots, filepath.Join(p, "src"))
+	}
+	return roots
+}
+
+// moduleCache returns the directory of the local module cache.
+func moduleCache() string {
+	if modcache := os.Getenv("GOMODCACHE"); modcache != "" {
+		return modcache
+	}
+	if gopath := filepath.SplitList(build.Default.GOPATH); len(gopath) > 0 {
+		return filepath.Join(gopath[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// importPaths returns the suffixes of a slash-separated source path
+// that may start with an import path, with any module versions and
+// module cache escapes removed. The suffixes following a "/src/",
+// "/pkg/mod/" or "/vendor/" element are returned first.
+func importPaths(p string) []string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if at := strings.Index(part, "@"); at > 0 {
+			part = part[:at]
+		}
+		parts[i] = unescapeModulePath(part)
+	}
+	var first, rest []string
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "" {
+			continue
+		}
+		s := strings.Join(parts[i:], "/")
+		if i > 0 && (parts[i-1] == "src" || parts[i-1] == "vendor" ||
+			parts[i-1] == "mod" && i > 1 && parts[i-2] == "pkg") {
+			first = append(first, s)
+		} else {
+			rest = append(rest, s)
+		}
+	}
+	return append(first, rest...)
+}
+
+// trimModulePath returns the path of a file of module mod relative to
+// the module root.
+func trimModulePath(p, mod string) (string, bool) {
+	if mod == "" || !strings.HasPrefix(p, mod+"/") {
+		return "", false
+	}
+	return p[len(mod)+1:], true
+}
+
+// moduleFile returns the path of a file of a module in the module
+// cache.
+func moduleFile(modcache, mod, version, rest string) string {
+	return filepath.Join(modcache, filepath.FromSlash(escapeModulePath(mod)+"@"+version), filepath.FromSlash(rest))
+}
+
+// escapeModulePath escapes upper case letters in a module path the
+// way the module cache does, replacing them by an exclamation mark
+// followed by the lower case letter.
+func escapeModulePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// unescapeModulePath reverts escapeModulePath.
+func unescapeModulePath(p string) string {
+	if !strings.Contains(p, "!") {
+		return p
+	}
+	var b strings.Builder
+	bang := false
+	for _, r := range p {
+		switch {
+		case r == '!':
+			bang = true
+			continue
+		case bang:
+			r = unicode.ToUpper(r)
+		}
+		bang = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// goMod holds the module information of a go.mod file needed to
+// locate sources.
+type goMod struct {
+	module  string
+	require map[string]string // module path to version
+	replace map[string]moduleVersion
+}
+
+type moduleVersion struct {
+	path, version string // version is empty for directory replacements
+}
+
+// parseGoMod parses the module, require and replace directives of a
+// go.mod file.
+func parseGoMod(name string) (*goMod, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mf := &goMod{
+		require: make(map[string]string),
+		replace: make(map[string]moduleVersion),
+	}
+	var block string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		for i, f := range fields {
+			fields[i] = strings.Trim(f, `"`)
+		}
+		switch fields[0] {
+		case "module":
+			if len(fields) > 1 {
+				mf.module = fields[1]
+			}
+		case "require":
+			if len(fields) > 2 {
+				mf.require[fields[1]] = fields[2]
+			}
+		case "replace":
+			// replace old [version] => new [version]
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 2 || arrow+1 >= len(fields) {
+				continue
+			}
+			r := moduleVersion{path: fields[arrow+1]}
+			if arrow+2 < len(fields) {
+				r.version = fields[arrow+2]
+			}
+			mf.replace[fields[1]] = r
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if mf.module == "" {
+		return nil, fmt.Errorf("%s: no module directive", name)
+	}
+	return mf, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package report
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testGoMod = `module example.com/app
+
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	golang.org/x/sync v0.5.0 // indirect
+)
+
+require example.com/lib v1.0.0
+
+replace example.com/lib => ../lib
+
+replace golang.org/x/sync v0.5.0 => golang.org/x/sync v0.6.0
+`
+
+func TestModuleRule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gomod := filepath.Join(dir, "go.mod")
+	if err := ioutil.WriteFile(gomod, []byte(testGoMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GOMODCACHE", "/modcache")
+	defer os.Unsetenv("GOMODCACHE")
+
+	rule, err := ModuleRule(gomod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"/src/example.com/app/cmd/main.go", filepath.Join(dir, "cmd/main.go")},
+		{"example.com/app/main.go", filepath.Join(dir, "main.go")},
+		{"/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.1/decode.go", "/modcache/github.com/!burnt!sushi/toml@v1.3.2/decode.go"},
+		{"github.com/BurntSushi/toml/decode.go", "/modcache/github.com/!burnt!sushi/toml@v1.3.2/decode.go"},
+		{"/go/src/golang.org/x/sync/errgroup/errgroup.go", "/modcache/golang.org/x/sync@v0.6.0/errgroup/errgroup.go"},
+		{"/build/vendor/example.com/lib/lib.go", filepath.Join(dir, "../lib/lib.go")},
+	} {
+		got := rule(tc.path)
+		if len(got) == 0 || got[0] != tc.want {
+			t.Errorf("rule(%q) = %q, want first candidate %q", tc.path, got, tc.want)
+		}
+	}
+	if got := rule("/usr/local/go/src/runtime/proc.go"); len(got) != 0 {
+		t.Errorf("rule of a file outside of the modules = %q, want none", got)
+	}
+}
+
+func TestVendorRule(t *testing.T) {
+	rule := VendorRule("/app/vendor")
+	got := rule("/go/pkg/mod/github.com/pkg/errors@v0.9.1/errors.go")
+	want := []string{
+		"/app/vendor/github.com/pkg/errors/errors.go",
+		"/app/vendor/go/pkg/mod/github.com/pkg/errors/errors.go",
+		"/app/vendor/pkg/mod/github.com/pkg/errors/errors.go",
+		"/app/vendor/mod/github.com/pkg/errors/errors.go",
+		"/app/vendor/pkg/errors/errors.go",
+		"/app/vendor/errors/errors.go",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rule() = %q, want %q", got, want)
+	}
+}
+
+func TestParsePathRules(t *testing.T) {
+	rules, err := ParsePathRules("/src=/home/me/app, vendor:/home/me/app/vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	if got, want := rules[0]("/src/main.go"), []string{"/home/me/app/main.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("prefix rule = %q, want %q", got, want)
+	}
+	if _, err := ParsePathRules("bogus"); err == nil {
+		t.Error("want error for an unrecognized rule")
+	}
+}
+
+func TestAdjustSourcePathTrimsFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules := []PathRule{PrefixRule("pkg", dir)}
+	for _, p := range []string{
+		"/proc/self/cwd/pkg/a.go",
+		"/home/u/.cache/bazel/_bazel_u/1f2e/execroot/__main__/pkg/a.go",
+	} {
+		if got := sourcePath(p, rules); got != file {
+			t.Errorf("sourcePath(%q) = %q, want %q", p, got, file)
+		}
+	}
+}
+
+func TestTrimPath(t *testing.T) {
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/proc/self/cwd/./pkg/a.go", "pkg/a.go"},
+		{"/home/u/.cache/bazel/_bazel_u/1f2e/sandbox/linux-sandbox/12/execroot/__main__/pkg/a.go", "pkg/a.go"},
+		{"/home/u/.cache/bazel/_bazel_u/1f2e/execroot/__main__/pkg/a.go", "pkg/a.go"},
+		{"/usr/local/go/src/runtime/proc.go", "/usr/local/go/src/runtime/proc.go"},
+	} {
+		if got := trimPath(tc.path); got != tc.want {
+			t.Errorf("trimPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
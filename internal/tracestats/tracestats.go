@@ -0,0 +1,225 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracestats breaks down the time of the goroutines of an
+// execution trace by state: running, runnable, blocked and in syscalls.
+package tracestats
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+// Times are the times spent in each state by a goroutine, or by a group
+// of goroutines, during a trace.
+type Times struct {
+	Running  time.Duration
+	Runnable time.Duration // Waiting to be scheduled.
+	Blocked  time.Duration
+	Syscall  time.Duration
+}
+
+// Total returns the time spent in all the states.
+func (t *Times) Total() time.Duration {
+	return t.Running + t.Runnable + t.Blocked + t.Syscall
+}
+
+func (t *Times) add(u *Times) {
+	t.Running += u.Running
+	t.Runnable += u.Runnable
+	t.Blocked += u.Blocked
+	t.Syscall += u.Syscall
+}
+
+// A Goroutine is a goroutine of a trace.
+type Goroutine struct {
+	ID int64
+
+	// Function is the function the goroutine started with, or empty if
+	// unknown.
+	Function string
+
+	Times
+}
+
+// A Group is the goroutines of a trace that started with the same
+// function.
+type Group struct {
+	Function string
+	Count    int
+	Times
+}
+
+// A Summary is the time of the goroutines of a trace by state.
+type Summary struct {
+	Duration time.Duration
+
+	// Goroutines and Groups are sorted by decreasing total time.
+	Goroutines []*Goroutine
+	Groups     []*Group
+
+	// Blocked is the time the goroutines were blocked by reason, by
+	// decreasing time.
+	Blocked []*Reason
+}
+
+// A Reason is a reason goroutines were blocked for, e.g. chan receive
+// or sync. It is empty for the goroutines blocked since the start of
+// the trace.
+type Reason struct {
+	Reason  string
+	Blocked time.Duration
+}
+
+// goroutine is a goroutine while reading a trace.
+type goroutine struct {
+	*Goroutine
+	state  trace.GoState
+	since  trace.Time
+	reason string // Why the goroutine is blocked.
+}
+
+// account adds the time spent in the current state up to t, and the
+// time blocked to reasons.
+func (g *goroutine) account(t trace.Time, reasons map[string]time.Duration) {
+	d := time.Duration(t - g.since)
+	switch g.state {
+	case trace.GoRunning:
+		g.Running += d
+	case trace.GoRunnable:
+		g.Runnable += d
+	case trace.GoWaiting:
+		g.Blocked += d
+		reasons[g.reason] += d
+	case trace.GoSyscall:
+		g.Syscall += d
+	}
+	g.since = t
+}
+
+// Parse reads an execution trace, as written by runtime/trace, and
+// summarizes the time of its goroutines.
+func Parse(r io.Reader) (*Summary, error) {
+	tr, err := trace.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &Summary{}
+	gs := make(map[trace.GoID]*goroutine)
+	reasons := make(map[string]time.Duration)
+	var start, end trace.Time
+	for n := 0; ; n++ {
+		ev, err := tr.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			start = ev.Time()
+		}
+		end = ev.Time()
+		if ev.Kind() != trace.EventStateTransition {
+			continue
+		}
+		st := ev.StateTransition()
+		if st.Resource.Kind != trace.ResourceGoroutine {
+			continue
+		}
+		id := st.Resource.Goroutine()
+		_, to := st.Goroutine()
+		g, ok := gs[id]
+		if !ok {
+			g = &goroutine{Goroutine: &Goroutine{ID: int64(id)}}
+			gs[id] = g
+		}
+		// The state of goroutines is undetermined until they
+		// transition, and so is not accounted.
+		g.account(ev.Time(), reasons)
+		g.state, g.reason = to, st.Reason
+		if g.Function == "" {
+			g.Function = outermost(st.Stack)
+		}
+	}
+	s.Duration = time.Duration(end - start)
+
+	groups := make(map[string]*Group)
+	for _, g := range gs {
+		g.account(end, reasons)
+		s.Goroutines = append(s.Goroutines, g.Goroutine)
+		gr, ok := groups[g.Function]
+		if !ok {
+			gr = &Group{Function: g.Function}
+			groups[g.Function] = gr
+			s.Groups = append(s.Groups, gr)
+		}
+		gr.Count++
+		gr.add(&g.Times)
+	}
+	for r, d := range reasons {
+		s.Blocked = append(s.Blocked, &Reason{r, d})
+	}
+	sort.Sort(goroutines(s.Goroutines))
+	sort.Sort(groupList(s.Groups))
+	sort.Sort(reasonList(s.Blocked))
+	return s, nil
+}
+
+// outermost returns the function of the outermost frame of stk, the
+// function the goroutine started with, or empty if stk is empty.
+func outermost(stk trace.Stack) string {
+	var fn string
+	stk.Frames()(func(f trace.StackFrame) bool {
+		fn = f.Func
+		return true
+	})
+	return fn
+}
+
+type goroutines []*Goroutine
+
+func (s goroutines) Len() int      { return len(s) }
+func (s goroutines) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s goroutines) Less(i, j int) bool {
+	if ti, tj := s[i].Total(), s[j].Total(); ti != tj {
+		return ti > tj
+	}
+	return s[i].ID < s[j].ID
+}
+
+type groupList []*Group
+
+func (s groupList) Len() int      { return len(s) }
+func (s groupList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s groupList) Less(i, j int) bool {
+	if ti, tj := s[i].Total(), s[j].Total(); ti != tj {
+		return ti > tj
+	}
+	return s[i].Function < s[j].Function
+}
+
+type reasonList []*Reason
+
+func (s reasonList) Len() int      { return len(s) }
+func (s reasonList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s reasonList) Less(i, j int) bool {
+	if s[i].Blocked != s[j].Blocked {
+		return s[i].Blocked > s[j].Blocked
+	}
+	return s[i].Reason < s[j].Reason
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracestats
+
+import (
+	"bytes"
+	"runtime/trace"
+	"sync"
+	"testing"
+	"time"
+)
+
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func blocked(ch chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	<-ch
+}
+
+func TestParse(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("tracing: %v", err)
+	}
+	ch := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go blocked(ch, &wg)
+	}
+	time.Sleep(50 * time.Millisecond)
+	spin(20 * time.Millisecond)
+	close(ch)
+	wg.Wait()
+	trace.Stop()
+
+	s, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Duration < 50*time.Millisecond {
+		t.Errorf("got a duration of %v, want at least 50ms", s.Duration)
+	}
+	var g *Group
+	for _, gr := range s.Groups {
+		if gr.Function == "github.com/rakyll/gom/internal/tracestats.blocked" {
+			g = gr
+		}
+	}
+	if g == nil {
+		t.Fatalf("no group of the blocked goroutines in %d groups", len(s.Groups))
+	}
+	if g.Count != 3 {
+		t.Errorf("got %d blocked goroutines, want 3", g.Count)
+	}
+	if g.Blocked < 3*40*time.Millisecond {
+		t.Errorf("got %v blocked, want at least 120ms", g.Blocked)
+	}
+	var chanBlocked time.Duration
+	for _, r := range s.Blocked {
+		if r.Reason == "chan receive" {
+			chanBlocked = r.Blocked
+		}
+	}
+	if chanBlocked < g.Blocked {
+		t.Errorf("got %v blocked on chan receive, want at least %v", chanBlocked, g.Blocked)
+	}
+	var running time.Duration
+	for _, g := range s.Goroutines {
+		running += g.Running
+	}
+	if running < 20*time.Millisecond {
+		t.Errorf("got %v running, want at least 20ms", running)
+	}
+}